@@ -0,0 +1,65 @@
+package ldap
+
+import (
+	"context"
+	"sort"
+
+	"github.com/stesla/ldap/asn1"
+)
+
+type addRequest struct {
+	Entry      []byte
+	Attributes []attribute
+}
+
+func (l *conn) Add(dn string, attrs map[string][]string) error {
+	return l.AddContext(context.Background(), dn, attrs)
+}
+
+func (l *conn) AddContext(ctx context.Context, dn string, attrs map[string][]string) error {
+	_, err := l.AddWithControls(ctx, dn, attrs, nil)
+	return err
+}
+
+// AddWithControls is like AddContext, but sends controls with the
+// request and returns the controls from the response, even if the add
+// fails.
+func (l *conn) AddWithControls(ctx context.Context, dn string, attrs map[string][]string, controls []Control) ([]Control, error) {
+	req := addRequest{Entry: []byte(dn), Attributes: makeAttributes(attrs)}
+
+	var result ldapResult
+	respControls, err := l.roundTrip(ctx,
+		asn1.OptionValue{Opts: "application,tag:8", Value: req},
+		asn1.OptionValue{Opts: "application,tag:9", Value: &result}, controls)
+	if err != nil {
+		return nil, err
+	}
+
+	return respControls, l.chase(ctx, result.err(), dn, func(ctx context.Context, c Conn, dn string) error {
+		return c.AddContext(ctx, dn, attrs)
+	})
+}
+
+// makeAttributes converts attrs to an attribute list, sorted by
+// attribute type so that the encoding is deterministic.
+func makeAttributes(attrs map[string][]string) []attribute {
+	types := make([]string, 0, len(attrs))
+	for t := range attrs {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	result := make([]attribute, len(types))
+	for i, t := range types {
+		result[i] = attribute{Type: []byte(t), Values: makeValues(attrs[t])}
+	}
+	return result
+}
+
+func makeValues(vals []string) [][]byte {
+	result := make([][]byte, len(vals))
+	for i, v := range vals {
+		result[i] = []byte(v)
+	}
+	return result
+}
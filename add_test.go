@@ -0,0 +1,53 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stesla/ldap/asn1"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestAdd(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, op := s.readRequest()
+		var req addRequest
+		if s.decodeRequest(op, "application,tag:8", &req) {
+			assert.Equal(t, "cn=Bob,ou=users,dc=example,dc=org", string(req.Entry))
+			assert.Equal(t, []attribute{
+				{[]byte("cn"), [][]byte{[]byte("Bob")}},
+				{[]byte("objectClass"), [][]byte{[]byte("top"), []byte("person")}},
+				{[]byte("sn"), [][]byte{[]byte("Lastname")}},
+			}, req.Attributes)
+		}
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:9", Value: ldapResult{}})
+	})
+	defer wait()
+
+	err := conn.Add("cn=Bob,ou=users,dc=example,dc=org", map[string][]string{
+		"objectClass": {"top", "person"},
+		"cn":          {"Bob"},
+		"sn":          {"Lastname"},
+	})
+	assert.NoError(t, err)
+}
+
+func TestAddFailure(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readRequest()
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:9", Value: ldapResult{
+			ResultCode: EntryAlreadyExists,
+			Message:    []byte("entry already exists"),
+		}})
+	})
+	defer wait()
+
+	err := conn.Add("cn=Alice Lastname,ou=users,dc=example,dc=org", map[string][]string{
+		"cn": {"Alice Lastname"},
+	})
+	var rerr *ResultError
+	if assert.True(t, errors.As(err, &rerr), "expected *ResultError, got %v", err) {
+		assert.Equal(t, EntryAlreadyExists, rerr.ResultCode)
+		assert.Equal(t, "entry already exists", rerr.Message)
+	}
+}
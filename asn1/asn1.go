@@ -26,19 +26,19 @@ const ( // ASN.1 Universal Tags
 	// TagReal             = 0x09
 	TagEnumerated = 0x0a
 	// TagEmbeddedPDV      = 0x0b
-	// TagUTF8String       = 0x0c
+	TagUTF8String = 0x0c
 	// TagRelativeOID      = 0x0d
-	TagSequence = 0x10
-	TagSet      = 0x11
-	// TagNumericString    = 0x12
-	// TagPrintableString  = 0x13
-	// TagT61String        = 0x14
+	TagSequence        = 0x10
+	TagSet             = 0x11
+	TagNumericString   = 0x12
+	TagPrintableString = 0x13
+	TagT61String       = 0x14
 	// TagVideotexString   = 0x15
-	// TagIA5String        = 0x16
+	TagIA5String = 0x16
 	// TagUTCTime          = 0x17
 	// TagGeneralizedTime  = 0x18
 	// TagGraphicString    = 0x19
-	// TagVisibleString    = 0x1a
+	TagVisibleString = 0x1a
 	// TagGeneralString    = 0x1b
 	// TagUniversalString  = 0x1c
 	// TagCharacterString  = 0x1d
@@ -181,8 +181,7 @@ func (dec *Decoder) decodeSequenceStruct(v reflect.Value) (err error) {
 			if err == EOC {
 				dec.b = append(dec.b, 0x00, 0x00)
 			} else {
-				n := copy(dec.b[:cap(dec.b)], dec.typeb)
-				dec.b = dec.b[:n]
+				dec.b = append(dec.b[:0], dec.typeb...)
 			}
 			err = nil
 		}
@@ -301,7 +300,8 @@ func (dec *Decoder) decodeContent(length int, indefinite bool) (b []byte, err er
 }
 
 func (dec *Decoder) decodeLength() (length int, isIndefinite bool, err error) {
-	_, err = dec.Read(dec.lenb[0:1])
+	dec.lenb = dec.lenb[:1]
+	_, err = dec.Read(dec.lenb)
 	if err != nil {
 		return
 	}
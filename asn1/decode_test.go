@@ -117,6 +117,24 @@ func TestDecodeRawValue(t *testing.T) {
 	runDecoderTests(t, tests, withValue(&out))
 }
 
+func TestDecodeRawValuesFromStream(t *testing.T) {
+	in := []byte{0x04, 0x81, 0x03, 'f', 'o', 'o', 0x04, 0x03, 'b', 'a', 'r'}
+	dec := NewDecoder(bytes.NewReader(in))
+	expected := []RawValue{
+		{0, 4, false, []byte("foo"), []byte{0x04, 0x81, 0x03, 'f', 'o', 'o'}},
+		{0, 4, false, []byte("bar"), []byte{0x04, 0x03, 'b', 'a', 'r'}},
+	}
+	for i, e := range expected {
+		var out RawValue
+		if err := dec.Decode(&out); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(e, out) {
+			t.Errorf("#%d: Bad result: %v (expected %v)", i, out, e)
+		}
+	}
+}
+
 func TestDecodeBool(t *testing.T) {
 	tests := []decoderTest{
 		{[]byte{0x01, 0x01, 0x00}, true, false},
@@ -339,6 +357,23 @@ func TestDecodeOptionalStructFields(t *testing.T) {
 	runDecoderTests(t, tests, withValue(&out))
 }
 
+func TestDecodeOptionalStructFieldsFromStream(t *testing.T) {
+	var in []byte
+	for i := 0; i < 20; i++ {
+		in = append(in, 0x30, 0x03, 0x80, 0x01, byte(i))
+	}
+	dec := NewDecoder(bytes.NewReader(in))
+	for i := 0; i < 20; i++ {
+		var out opoint
+		if err := dec.Decode(&out); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if expected := (opoint{Y: i}); out != expected {
+			t.Errorf("%d: expected %v, got %v", i, expected, out)
+		}
+	}
+}
+
 func TestDecodeIndirectOptions(t *testing.T) {
 	a, b := 4, 2
 	test := []decoderTest{
@@ -0,0 +1,53 @@
+package ldap
+
+import (
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+// readSimpleBind reads a simple bind request from the client,
+// returning its message id, name and password.
+func (s *testServer) readSimpleBind() (id int, name, password string) {
+	id, op := s.readRequest()
+	var req testBindRequest
+	if !s.decodeRequest(op, "application,tag:0", &req) {
+		return
+	}
+	assert.Equal(s.t, 3, int(req.Version))
+	var auth []byte
+	s.decodeRequest(req.Auth, "tag:0", &auth)
+	return id, string(req.Name), string(auth)
+}
+
+func TestSimpleBinds(t *testing.T) {
+	tests := []struct {
+		bind           func(c *conn) error
+		name, password string
+	}{
+		{func(c *conn) error { return c.Bind("cn=admin,dc=example,dc=org", "secret") }, "cn=admin,dc=example,dc=org", "secret"},
+		{func(c *conn) error { return c.Bind("", "") }, "", ""},
+		{func(c *conn) error { return c.AnonymousBind() }, "", ""},
+		{func(c *conn) error { return c.UnauthenticatedBind("cn=admin,dc=example,dc=org") }, "cn=admin,dc=example,dc=org", ""},
+	}
+	for _, test := range tests {
+		func() {
+			conn, wait := newTestConn(t, func(s *testServer) {
+				id, name, password := s.readSimpleBind()
+				assert.Equal(t, test.name, name)
+				assert.Equal(t, test.password, password)
+				s.writeBindResponse(id, Success, nil)
+			})
+			defer wait()
+
+			assert.NoError(t, test.bind(conn))
+		}()
+	}
+}
+
+func TestBindRejectsEmptyPassword(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {})
+	defer wait()
+
+	assert.Equal(t, ErrEmptyPassword, conn.Bind("cn=admin,dc=example,dc=org", ""))
+}
@@ -0,0 +1,54 @@
+package ldap
+
+import (
+	"context"
+
+	"github.com/stesla/ldap/asn1"
+)
+
+type compareRequest struct {
+	Entry     []byte
+	Assertion attributeValueAssertion
+}
+
+// Compare reports whether the entry dn has the given value for
+// attribute.
+func (l *conn) Compare(dn, attribute, value string) (bool, error) {
+	return l.CompareContext(context.Background(), dn, attribute, value)
+}
+
+func (l *conn) CompareContext(ctx context.Context, dn, attribute, value string) (bool, error) {
+	ok, _, err := l.CompareWithControls(ctx, dn, attribute, value, nil)
+	return ok, err
+}
+
+// CompareWithControls is like CompareContext, but sends controls with
+// the request and returns the controls from the response, even if the
+// compare fails.
+func (l *conn) CompareWithControls(ctx context.Context, dn, attribute, value string, controls []Control) (bool, []Control, error) {
+	req := compareRequest{
+		Entry:     []byte(dn),
+		Assertion: attributeValueAssertion{[]byte(attribute), []byte(value)},
+	}
+
+	var result ldapResult
+	respControls, err := l.roundTrip(ctx,
+		asn1.OptionValue{Opts: "application,tag:14", Value: req},
+		asn1.OptionValue{Opts: "application,tag:15", Value: &result}, controls)
+	if err != nil {
+		return false, nil, err
+	}
+
+	switch result.ResultCode {
+	case CompareTrue:
+		return true, respControls, nil
+	case CompareFalse:
+		return false, respControls, nil
+	}
+	var ok bool
+	err = l.chase(ctx, result.resultError(), dn, func(ctx context.Context, c Conn, dn string) (err error) {
+		ok, err = c.CompareContext(ctx, dn, attribute, value)
+		return
+	})
+	return ok, respControls, err
+}
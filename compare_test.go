@@ -0,0 +1,44 @@
+package ldap
+
+import (
+	"testing"
+
+	"github.com/stesla/ldap/asn1"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestCompare(t *testing.T) {
+	var tests = []struct {
+		code     ResultCode
+		expected bool
+		ok       bool
+	}{
+		{CompareTrue, true, true},
+		{CompareFalse, false, true},
+		{Success, false, false},
+		{NoSuchAttribute, false, false},
+	}
+
+	dn := "cn=users,ou=groups,dc=example,dc=org"
+	for _, test := range tests {
+		func() {
+			conn, wait := newTestConn(t, func(s *testServer) {
+				id, op := s.readRequest()
+				var req compareRequest
+				if s.decodeRequest(op, "application,tag:14", &req) {
+					assert.Equal(t, dn, string(req.Entry))
+					assert.Equal(t, "memberUid", string(req.Assertion.Attribute))
+					assert.Equal(t, "alice", string(req.Assertion.Value))
+				}
+				s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:15", Value: ldapResult{
+					ResultCode: test.code,
+				}})
+			})
+			defer wait()
+
+			ok, err := conn.Compare(dn, "memberUid", "alice")
+			assert.Equal(t, test.expected, ok, "resultCode = %d", test.code)
+			assert.Equal(t, test.ok, err == nil, "resultCode = %d: %v", test.code, err)
+		}()
+	}
+}
@@ -0,0 +1,323 @@
+package ldap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/stesla/ldap/asn1"
+)
+
+// conn multiplexes operations over a single connection. Requests may
+// be written by any goroutine, while a single reader goroutine
+// decodes every response and hands it to the operation waiting on
+// its message id.
+type conn struct {
+	net.Conn
+	id sequence
+
+	wl chan struct{} // holds a token while a message is written
+
+	mu     sync.Mutex
+	ops    map[int]*operation
+	err    error // why the reader stopped
+	chaser *referralChaser
+}
+
+func newConn(tcp net.Conn) *conn {
+	l := &conn{
+		Conn: tcp,
+		wl:   make(chan struct{}, 1),
+		ops:  make(map[int]*operation),
+	}
+	go l.reader()
+	return l
+}
+
+// operation is an outstanding request.
+type operation struct {
+	id          int
+	conn        *conn
+	abandonable bool
+
+	// The reader appends responses to queue and signals notify, so
+	// that an operation whose responses are not being read never
+	// holds up the reader, and so every other operation.
+	mu     sync.Mutex
+	queue  []*packet
+	closed bool // the reader has stopped
+	notify chan struct{}
+
+	// If pause is not nil, the reader stops after delivering a
+	// response to this operation until pause is closed. StartTLS
+	// uses this to take over the connection for the handshake.
+	pause chan struct{}
+}
+
+// packet is a single LDAPMessage read from the connection.
+type packet struct {
+	MessageId  int
+	ProtocolOp asn1.RawValue
+	Controls   []control
+}
+
+// decode decodes the protocolOp of p into out, which must match opts.
+func (p *packet) decode(opts string, out interface{}) error {
+	dec := asn1.NewDecoder(bytes.NewBuffer(p.ProtocolOp.RawBytes))
+	dec.Implicit = true
+	if err := dec.Decode(asn1.OptionValue{Opts: opts, Value: out}); err != nil {
+		return fmt.Errorf("Decode: %v", err)
+	}
+	return nil
+}
+
+func (l *conn) reader() {
+	dec := asn1.NewDecoder(l)
+	dec.Implicit = true
+	for {
+		var p packet
+		msg := ldapMessage{ProtocolOp: &p.ProtocolOp}
+		if err := dec.Decode(&msg); err != nil {
+			l.shutdown(fmt.Errorf("Decode: %v", err))
+			return
+		}
+		p.MessageId, p.Controls = msg.MessageId, msg.Controls
+
+		if p.MessageId == 0 {
+			l.unsolicited(&p)
+			continue
+		}
+
+		l.mu.Lock()
+		op := l.ops[p.MessageId]
+		l.mu.Unlock()
+		if op == nil {
+			// The operation has already finished or been
+			// abandoned, so there is nobody to tell.
+			continue
+		}
+
+		op.deliver(&p)
+		if op.pause != nil {
+			<-op.pause
+		}
+	}
+}
+
+// unsolicited handles an unsolicited notification (RFC 4511 section
+// 4.4). The only one defined is the Notice of Disconnection, after
+// which the server closes the connection, so we remember why.
+func (l *conn) unsolicited(p *packet) {
+	var r extendedResponse
+	if err := p.decode("application,tag:24", &r); err != nil {
+		return
+	}
+	if err := r.Result.err(); err != nil {
+		l.mu.Lock()
+		if l.err == nil {
+			l.err = err
+		}
+		l.mu.Unlock()
+	}
+}
+
+// shutdown fails every outstanding operation, and every operation
+// started after it, with err.
+func (l *conn) shutdown(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err == nil {
+		l.err = err
+	}
+	for _, op := range l.ops {
+		op.close()
+	}
+	l.ops = nil
+}
+
+// send writes a single message to the connection. It waits for other
+// writes only until ctx is done, and a write still in progress at
+// ctx's deadline fails. If part of the message was written, the
+// connection is closed, since the server cannot make sense of what
+// follows.
+func (l *conn) send(ctx context.Context, id int, protocolOp interface{}, controls ...control) error {
+	var buf bytes.Buffer
+	msg := ldapMessage{MessageId: id, ProtocolOp: protocolOp, Controls: controls}
+	enc := asn1.NewEncoder(&buf)
+	enc.Implicit = true
+	if err := enc.Encode(msg); err != nil {
+		return fmt.Errorf("Encode: %v", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case l.wl <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-l.wl }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		l.SetWriteDeadline(deadline)
+	}
+	if done := ctx.Done(); done != nil {
+		// Cancelling ctx unblocks the write by moving its deadline
+		// into the past.
+		stop, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-done:
+				l.SetWriteDeadline(time.Unix(1, 0))
+			case <-stop:
+			}
+		}()
+		defer func() { close(stop); <-stopped }()
+	}
+	defer l.SetWriteDeadline(time.Time{})
+	if n, err := l.Write(buf.Bytes()); err != nil {
+		if n > 0 {
+			l.Close()
+		}
+		if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			// The write deadline may pass before ctx notices.
+			return context.DeadlineExceeded
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// start sends req with a new message id and returns the operation
+// that will receive its responses. The caller must call finish on
+// the operation when it is done with it.
+func (l *conn) start(ctx context.Context, req interface{}, controls ...control) (*operation, error) {
+	return l.startPaused(ctx, req, nil, controls)
+}
+
+func (l *conn) startPaused(ctx context.Context, req interface{}, pause chan struct{}, controls []control) (*operation, error) {
+	op := &operation{
+		id:          l.id.Next(),
+		conn:        l,
+		notify:      make(chan struct{}, 1),
+		abandonable: canAbandon(req),
+		pause:       pause,
+	}
+
+	l.mu.Lock()
+	if l.ops == nil {
+		l.mu.Unlock()
+		return nil, l.err
+	}
+	l.ops[op.id] = op
+	l.mu.Unlock()
+
+	if err := l.send(ctx, op.id, req, controls...); err != nil {
+		op.finish()
+		return nil, err
+	}
+	return op, nil
+}
+
+// canAbandon reports whether req may be abandoned. RFC 4511 section
+// 4.11 forbids abandoning Bind and StartTLS.
+func canAbandon(req interface{}) bool {
+	if ov, ok := req.(asn1.OptionValue); ok {
+		req = ov.Value
+	}
+	switch r := req.(type) {
+	case bindRequest:
+		return false
+	case extendedRequest:
+		return string(r.Name) != startTLSOID
+	}
+	return true
+}
+
+// deliver queues p for op. It never blocks.
+func (op *operation) deliver(p *packet) {
+	op.mu.Lock()
+	op.queue = append(op.queue, p)
+	op.mu.Unlock()
+	op.signal()
+}
+
+// close tells op that no more responses will arrive.
+func (op *operation) close() {
+	op.mu.Lock()
+	op.closed = true
+	op.mu.Unlock()
+	op.signal()
+}
+
+func (op *operation) signal() {
+	select {
+	case op.notify <- struct{}{}:
+	default:
+	}
+}
+
+// receive waits for the next response to op. If ctx is done first,
+// op is abandoned and ctx.Err() is returned.
+func (op *operation) receive(ctx context.Context) (*packet, error) {
+	for {
+		op.mu.Lock()
+		if len(op.queue) > 0 {
+			p := op.queue[0]
+			op.queue[0] = nil
+			op.queue = op.queue[1:]
+			op.mu.Unlock()
+			return p, nil
+		}
+		closed := op.closed
+		op.mu.Unlock()
+		if closed {
+			op.conn.mu.Lock()
+			defer op.conn.mu.Unlock()
+			return nil, op.conn.err
+		}
+
+		select {
+		case <-op.notify:
+		case <-ctx.Done():
+			op.abandon()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// abandonTimeout limits how long abandon waits to write its request,
+// since the caller has already given up on the operation.
+const abandonTimeout = time.Second
+
+// abandon asks the server to stop processing op. The server does not
+// respond to an abandon request, so we do not wait for anything.
+func (op *operation) abandon() {
+	if !op.abandonable {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), abandonTimeout)
+	defer cancel()
+	op.conn.send(ctx, op.conn.id.Next(), asn1.OptionValue{Opts: "application,tag:16", Value: op.id})
+}
+
+// finish stops delivery of any further responses to op.
+func (op *operation) finish() {
+	op.conn.mu.Lock()
+	if op.conn.ops != nil {
+		delete(op.conn.ops, op.id)
+	}
+	op.conn.mu.Unlock()
+
+	op.mu.Lock()
+	op.queue = nil
+	op.mu.Unlock()
+}
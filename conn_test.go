@@ -0,0 +1,286 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stesla/ldap/asn1"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+type testSearchRequest struct {
+	BaseObject []byte
+	Scope      int `asn1:"enum"`
+	Deref      int `asn1:"enum"`
+	SizeLimit  int
+	TimeLimit  int
+	TypesOnly  bool
+	Filter     asn1.RawValue
+	Attributes [][]byte
+}
+
+func searchEntry(dn string) asn1.OptionValue {
+	return asn1.OptionValue{Opts: "application,tag:4", Value: searchResultEntry{Name: []byte(dn)}}
+}
+
+func searchDone(code ResultCode) asn1.OptionValue {
+	return asn1.OptionValue{Opts: "application,tag:5", Value: ldapResult{ResultCode: code}}
+}
+
+func TestConcurrentSearches(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		ids := map[string]int{}
+		for i := 0; i < 2; i++ {
+			id, op := s.readRequest()
+			var req testSearchRequest
+			if !s.decodeRequest(op, "application,tag:3", &req) {
+				return
+			}
+			ids[string(req.BaseObject)] = id
+		}
+		users, groups := ids["ou=users,dc=example,dc=org"], ids["ou=groups,dc=example,dc=org"]
+		s.writeResponse(groups, searchEntry("cn=users,ou=groups,dc=example,dc=org"))
+		s.writeResponse(users, searchEntry("cn=Alice Lastname,ou=users,dc=example,dc=org"))
+		s.writeResponse(groups, searchDone(Success))
+		s.writeResponse(users, searchEntry("cn=Bob Lastname,ou=users,dc=example,dc=org"))
+		s.writeResponse(users, searchDone(Success))
+	})
+	defer wait()
+
+	var tests = []struct {
+		base     string
+		expected []string
+	}{
+		{"ou=users,dc=example,dc=org", []string{
+			"cn=Alice Lastname,ou=users,dc=example,dc=org",
+			"cn=Bob Lastname,ou=users,dc=example,dc=org",
+		}},
+		{"ou=groups,dc=example,dc=org", []string{
+			"cn=users,ou=groups,dc=example,dc=org",
+		}},
+	}
+
+	var wg sync.WaitGroup
+	for _, test := range tests {
+		wg.Add(1)
+		go func(base string, expected []string) {
+			defer wg.Done()
+			results, err := conn.Search(SearchRequest{
+				BaseObject: []byte(base),
+				Scope:      SingleLevel,
+				Filter:     Present("objectClass"),
+			})
+			if !assert.NoError(t, err, "searching %s", base) {
+				return
+			}
+			dns := []string{}
+			for _, r := range results {
+				dns = append(dns, r.DN)
+			}
+			assert.Equal(t, expected, dns)
+		}(test.base, test.expected)
+	}
+	wg.Wait()
+}
+
+// TestSlowOperationDoesNotBlockOthers performs an operation while a
+// search has many more responses queued than it has read.
+func TestSlowOperationDoesNotBlockOthers(t *testing.T) {
+	const entries = 40
+	conn, wait := newTestConn(t, func(s *testServer) {
+		searchID, _ := s.readRequest()
+		for i := 0; i < entries; i++ {
+			s.writeResponse(searchID, searchEntry(fmt.Sprintf("uid=user%d,ou=users,dc=example,dc=org", i)))
+		}
+		id, _ := s.readRequest()
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:7", Value: ldapResult{}})
+		s.writeResponse(searchID, searchDone(Success))
+	})
+	defer wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := conn.SearchStream(ctx, testStreamRequest)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close()
+
+	n := 0
+	for stream.Next() {
+		if n == 0 {
+			err := conn.ModifyContext(ctx, "uid=user0,ou=users,dc=example,dc=org", []Change{
+				{ReplaceValues, "description", []string{"seen"}},
+			})
+			assert.NoError(t, err)
+		}
+		n++
+	}
+	assert.NoError(t, stream.Err())
+	assert.Equal(t, entries, n)
+}
+
+func TestSendRespectsContext(t *testing.T) {
+	blocked := make(chan struct{})
+	conn, wait := newTestConn(t, func(s *testServer) {
+		// Never read, so the first request blocks its writer.
+		<-blocked
+	})
+	defer wait()
+	defer close(blocked)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := conn.DeleteContext(ctx, "uid=alice,ou=users,dc=example,dc=org")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+
+	go conn.Delete("uid=bob,ou=users,dc=example,dc=org")
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = conn.DeleteContext(ctx, "uid=carol,ou=users,dc=example,dc=org")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+}
+
+func TestSendRespectsCancel(t *testing.T) {
+	blocked := make(chan struct{})
+	conn, wait := newTestConn(t, func(s *testServer) {
+		// Never read, so the first request blocks its writer.
+		<-blocked
+	})
+	defer wait()
+	defer close(blocked)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err := conn.DeleteContext(ctx, "uid=alice,ou=users,dc=example,dc=org")
+	assert.Equal(t, context.Canceled, err)
+
+	// The write lock is free again.
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err = conn.DeleteContext(ctx, "uid=bob,ou=users,dc=example,dc=org")
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestOutstandingOperationsFailWhenConnectionCloses(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		s.readRequest()
+	})
+	defer wait()
+
+	_, err := conn.Compare("cn=users,ou=groups,dc=example,dc=org", "memberUid", "alice")
+	assert.Error(t, err)
+
+	_, err = conn.Compare("cn=users,ou=groups,dc=example,dc=org", "memberUid", "alice")
+	assert.Error(t, err)
+}
+
+func TestNoticeOfDisconnection(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		s.readRequest()
+		s.writeResponse(0, asn1.OptionValue{Opts: "application,tag:24", Value: extendedResponse{
+			Result: ldapResult{ResultCode: Unavailable},
+			Name:   []byte("1.3.6.1.4.1.1466.20036"),
+		}})
+	})
+	defer wait()
+
+	_, err := conn.Compare("cn=users,ou=groups,dc=example,dc=org", "memberUid", "alice")
+	assert.True(t, errors.Is(err, Unavailable), "expected unavailable, got %v", err)
+}
+
+func TestStartTLS(t *testing.T) {
+	serverConfig := &tls.Config{Certificates: []tls.Certificate{testCertificate(t, "localhost")}}
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, op := s.readRequest()
+		var req extendedRequest
+		if !s.decodeRequest(op, "application,tag:23", &req) {
+			return
+		}
+		assert.Equal(t, "1.3.6.1.4.1.1466.20037", string(req.Name))
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:24", Value: extendedResponse{}})
+		if !s.startTLS(serverConfig) {
+			return
+		}
+
+		id, _ = s.readRequest()
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:15", Value: ldapResult{
+			ResultCode: CompareTrue,
+		}})
+	})
+	defer wait()
+
+	err := conn.StartTLS(&tls.Config{InsecureSkipVerify: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, ok := conn.Conn.(*tls.Conn)
+	assert.True(t, ok, "expected a TLS connection")
+
+	ok, err = conn.Compare("cn=users,ou=groups,dc=example,dc=org", "memberUid", "alice")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestCancelAbandonsOperation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, wait := newTestConn(t, func(s *testServer) {
+		searchId, _ := s.readRequest()
+		cancel()
+
+		_, op := s.readRequest()
+		assert.Equal(t, asn1.ClassApplication, op.Class)
+		assert.Equal(t, 16, op.Tag)
+		var abandoned int
+		if s.decodeRequest(op, "application,tag:16", &abandoned) {
+			assert.Equal(t, searchId, abandoned)
+		}
+		// A late response to the abandoned search is ignored.
+		s.writeResponse(searchId, searchDone(Success))
+
+		id, _ := s.readRequest()
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:15", Value: ldapResult{
+			ResultCode: CompareTrue,
+		}})
+	})
+	defer wait()
+
+	_, err := conn.SearchContext(ctx, SearchRequest{
+		BaseObject: []byte("dc=example,dc=org"),
+		Scope:      WholeSubtree,
+		Filter:     Present("objectClass"),
+	})
+	assert.Equal(t, context.Canceled, err)
+
+	ok, err := conn.Compare("cn=users,ou=groups,dc=example,dc=org", "memberUid", "alice")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestCancelBindDoesNotAbandon(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, wait := newTestConn(t, func(s *testServer) {
+		s.readRequest()
+		cancel()
+
+		id, op := s.readRequest()
+		assert.Equal(t, 14, op.Tag, "expected a compare request")
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:15", Value: ldapResult{
+			ResultCode: CompareFalse,
+		}})
+	})
+	defer wait()
+
+	err := conn.BindContext(ctx, "cn=Alice Lastname,ou=users,dc=example,dc=org", "password")
+	assert.Equal(t, context.Canceled, err)
+
+	ok, err := conn.Compare("cn=users,ou=groups,dc=example,dc=org", "memberUid", "alice")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
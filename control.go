@@ -0,0 +1,112 @@
+package ldap
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Control extends a request or response (RFC 4511 section 4.1.11).
+//
+// Controls are sent with a search in SearchRequest.Controls, and with
+// other operations by the WithControls variants of their methods,
+// which also return the controls the server sends with the result.
+// Anonymous binds are made with BindWithControls and an empty user and
+// password. UnauthenticatedBind, StartTLS and Unbind cannot send
+// controls.
+// The controls returned with the result of a search are available
+// from SearchStream.Controls, and those returned with each entry from
+// SearchStream.EntryControls. Response controls are decoded by the
+// ControlDecoder registered for their OID, or as RawControl if there
+// is none. Request controls are not sent to other servers when
+// following referrals.
+type Control interface {
+	OID() string
+	Critical() bool
+	// Value returns the encoded controlValue, or nil if the
+	// control has none.
+	Value() ([]byte, error)
+}
+
+// RawControl is a control whose value is left encoded.
+type RawControl struct {
+	Type         string
+	Criticality  bool
+	ControlValue []byte
+}
+
+func (c RawControl) OID() string            { return c.Type }
+func (c RawControl) Critical() bool         { return c.Criticality }
+func (c RawControl) Value() ([]byte, error) { return c.ControlValue, nil }
+
+// FindControl returns the first control in controls of type oid, or
+// nil if there is none.
+func FindControl(controls []Control, oid string) Control {
+	for _, c := range controls {
+		if c.OID() == oid {
+			return c
+		}
+	}
+	return nil
+}
+
+// ControlDecoder decodes a response control from its criticality and
+// encoded controlValue, which is nil if the control has none.
+type ControlDecoder func(criticality bool, value []byte) (Control, error)
+
+var (
+	controlDecodersMu sync.RWMutex
+	controlDecoders   = map[string]ControlDecoder{}
+)
+
+// RegisterControl registers decode as the decoder for response
+// controls of type oid, replacing any decoder already registered.
+func RegisterControl(oid string, decode ControlDecoder) {
+	controlDecodersMu.Lock()
+	defer controlDecodersMu.Unlock()
+	controlDecoders[oid] = decode
+}
+
+// decodeControls decodes response controls. A control that its
+// decoder rejects is returned as a RawControl unless it is critical,
+// since the server has already completed the operation.
+func decodeControls(controls []control) ([]Control, error) {
+	if len(controls) == 0 {
+		return nil, nil
+	}
+	controlDecodersMu.RLock()
+	defer controlDecodersMu.RUnlock()
+	result := make([]Control, len(controls))
+	for i, c := range controls {
+		raw := RawControl{string(c.Type), c.Criticality, c.Value}
+		decode, ok := controlDecoders[string(c.Type)]
+		if !ok {
+			result[i] = raw
+			continue
+		}
+		decoded, err := decode(c.Criticality, c.Value)
+		if err != nil {
+			if c.Criticality {
+				return nil, fmt.Errorf("Decode control %s: %v", c.Type, err)
+			}
+			decoded = raw
+		}
+		result[i] = decoded
+	}
+	return result, nil
+}
+
+// encodeControls encodes request controls.
+func encodeControls(controls []Control) ([]control, error) {
+	if len(controls) == 0 {
+		return nil, nil
+	}
+	result := make([]control, len(controls))
+	for i, c := range controls {
+		value, err := c.Value()
+		if err != nil {
+			return nil, fmt.Errorf("Encode control %s: %v", c.OID(), err)
+		}
+		result[i] = control{Type: []byte(c.OID()), Criticality: c.Critical(), Value: value}
+	}
+	return result, nil
+}
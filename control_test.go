@@ -0,0 +1,156 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stesla/ldap/asn1"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+// testControl is a control with a registered decoder.
+type testControl struct {
+	critical bool
+	value    string
+}
+
+const testControlOID = "1.3.6.1.4.1.99999.1"
+
+func (c testControl) OID() string            { return testControlOID }
+func (c testControl) Critical() bool         { return c.critical }
+func (c testControl) Value() ([]byte, error) { return []byte(c.value), nil }
+
+func init() {
+	RegisterControl(testControlOID, func(critical bool, value []byte) (Control, error) {
+		if string(value) == "bad" {
+			return nil, errors.New("bad value")
+		}
+		return testControl{critical, string(value)}, nil
+	})
+}
+
+func TestRequestAndResponseControls(t *testing.T) {
+	sent := []control{
+		{Type: []byte("1.2.3.4"), Criticality: true, Value: []byte("one")},
+		{Type: []byte(testControlOID), Value: []byte("two")},
+	}
+	returned := []control{
+		{Type: []byte("1.2.3.5"), Value: []byte("three")},
+		{Type: []byte(testControlOID), Criticality: true, Value: []byte("four")},
+	}
+	expected := []Control{
+		RawControl{"1.2.3.5", false, []byte("three")},
+		testControl{true, "four"},
+	}
+
+	conn, wait := newTestConn(t, func(s *testServer) {
+		// Compare
+		id, _, controls := s.readRequestControls()
+		assert.Equal(t, sent, controls)
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:15", Value: ldapResult{
+			ResultCode: CompareTrue,
+		}}, returned...)
+
+		// Extended
+		id, _, controls = s.readRequestControls()
+		assert.Equal(t, sent, controls)
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:24", Value: extendedResponse{}}, returned...)
+
+		// Search
+		id, _, controls = s.readRequestControls()
+		assert.Equal(t, sent, controls)
+		s.writeResponse(id, searchDone(Success), returned...)
+
+		// Delete, failing
+		id, _, controls = s.readRequestControls()
+		assert.Equal(t, sent, controls)
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:11", Value: ldapResult{
+			ResultCode: NoSuchObject,
+		}}, returned...)
+
+		// Bind, failing
+		id, _, controls = s.readRequestControls()
+		assert.Equal(t, sent, controls)
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:1", Value: bindResponse{
+			Result: ldapResult{ResultCode: InvalidCredentials},
+		}}, returned...)
+
+		// SASL bind, in two steps
+		id, _, controls = s.readRequestControls()
+		assert.Equal(t, sent, controls)
+		s.writeBindResponse(id, SaslBindInProgress, []byte("challenge"))
+		id, _, controls = s.readRequestControls()
+		assert.Equal(t, sent, controls)
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:1", Value: bindResponse{}}, returned...)
+	})
+	defer wait()
+
+	ctx := context.Background()
+	sending := []Control{RawControl{"1.2.3.4", true, []byte("one")}, testControl{false, "two"}}
+
+	ok, controls, err := conn.CompareWithControls(ctx, "cn=alice,dc=example,dc=org", "uid", "alice", sending)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, expected, controls)
+
+	_, controls, err = conn.ExtendedWithControls(ctx, "1.2.3.6", nil, sending)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, controls)
+
+	stream, err := conn.SearchStream(ctx, SearchRequest{
+		BaseObject: []byte("dc=example,dc=org"),
+		Scope:      WholeSubtree,
+		Controls:   sending,
+	})
+	if assert.NoError(t, err) {
+		assert.False(t, stream.Next())
+		assert.NoError(t, stream.Err())
+		controls, err = stream.Controls()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, controls)
+		stream.Close()
+	}
+
+	controls, err = conn.DeleteWithControls(ctx, "cn=alice,dc=example,dc=org", sending)
+	assert.True(t, errors.Is(err, NoSuchObject), "unexpected error: %v", err)
+	assert.Equal(t, expected, controls)
+
+	controls, err = conn.BindWithControls(ctx, "cn=alice,dc=example,dc=org", "secret", sending)
+	assert.True(t, errors.Is(err, InvalidCredentials), "unexpected error: %v", err)
+	assert.Equal(t, expected, controls)
+
+	m := &scriptedMechanism{responses: [][]byte{[]byte("response")}}
+	controls, err = conn.SASLBindWithControls(ctx, m, sending)
+	assert.NoError(t, err)
+	assert.True(t, m.done)
+	assert.Equal(t, expected, controls)
+}
+
+func TestResponseControlDecodeError(t *testing.T) {
+	bad := control{Type: []byte(testControlOID), Value: []byte("bad")}
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readRequest()
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:11", Value: ldapResult{}}, bad)
+
+		id, _ = s.readRequest()
+		bad.Criticality = true
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:11", Value: ldapResult{}}, bad)
+	})
+	defer wait()
+
+	// A malformed control does not fail a completed operation,
+	// unless it is critical.
+	controls, err := conn.DeleteWithControls(context.Background(), "cn=alice,dc=example,dc=org", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Control{RawControl{testControlOID, false, []byte("bad")}}, controls)
+
+	_, err = conn.DeleteWithControls(context.Background(), "cn=bob,dc=example,dc=org", nil)
+	assert.Error(t, err)
+}
+
+func TestFindControl(t *testing.T) {
+	controls := []Control{RawControl{Type: "1.2.3.4"}, testControl{value: "x"}}
+	assert.Equal(t, testControl{value: "x"}, FindControl(controls, testControlOID))
+	assert.Nil(t, FindControl(controls, "1.2.3.5"))
+}
@@ -0,0 +1,77 @@
+package ldap
+
+import (
+	"context"
+
+	"github.com/stesla/ldap/asn1"
+)
+
+func (l *conn) Delete(dn string) error {
+	return l.DeleteContext(context.Background(), dn)
+}
+
+func (l *conn) DeleteContext(ctx context.Context, dn string) error {
+	_, err := l.DeleteWithControls(ctx, dn, nil)
+	return err
+}
+
+// DeleteWithControls is like DeleteContext, but sends controls with
+// the request and returns the controls from the response, even if the
+// delete fails.
+func (l *conn) DeleteWithControls(ctx context.Context, dn string, controls []Control) ([]Control, error) {
+	var result ldapResult
+	respControls, err := l.roundTrip(ctx,
+		asn1.OptionValue{Opts: "application,tag:10", Value: []byte(dn)},
+		asn1.OptionValue{Opts: "application,tag:11", Value: &result}, controls)
+	if err != nil {
+		return nil, err
+	}
+
+	return respControls, l.chase(ctx, result.err(), dn, func(ctx context.Context, c Conn, dn string) error {
+		return c.DeleteContext(ctx, dn)
+	})
+}
+
+type modifyDNRequest struct {
+	Entry        []byte
+	NewRDN       []byte
+	DeleteOldRDN bool
+	NewSuperior  []byte `asn1:"tag:0,optional"`
+}
+
+// ModifyDN renames the entry dn to newRDN. If newSuperior is not
+// empty, the entry is also moved beneath it.
+func (l *conn) ModifyDN(dn, newRDN string, deleteOldRDN bool, newSuperior string) error {
+	return l.ModifyDNContext(context.Background(), dn, newRDN, deleteOldRDN, newSuperior)
+}
+
+func (l *conn) ModifyDNContext(ctx context.Context, dn, newRDN string, deleteOldRDN bool, newSuperior string) error {
+	_, err := l.ModifyDNWithControls(ctx, dn, newRDN, deleteOldRDN, newSuperior, nil)
+	return err
+}
+
+// ModifyDNWithControls is like ModifyDNContext, but sends controls
+// with the request and returns the controls from the response, even
+// if the rename fails.
+func (l *conn) ModifyDNWithControls(ctx context.Context, dn, newRDN string, deleteOldRDN bool, newSuperior string, controls []Control) ([]Control, error) {
+	req := modifyDNRequest{
+		Entry:        []byte(dn),
+		NewRDN:       []byte(newRDN),
+		DeleteOldRDN: deleteOldRDN,
+	}
+	if newSuperior != "" {
+		req.NewSuperior = []byte(newSuperior)
+	}
+
+	var result ldapResult
+	respControls, err := l.roundTrip(ctx,
+		asn1.OptionValue{Opts: "application,tag:12", Value: req},
+		asn1.OptionValue{Opts: "application,tag:13", Value: &result}, controls)
+	if err != nil {
+		return nil, err
+	}
+
+	return respControls, l.chase(ctx, result.err(), dn, func(ctx context.Context, c Conn, dn string) error {
+		return c.ModifyDNContext(ctx, dn, newRDN, deleteOldRDN, newSuperior)
+	})
+}
@@ -0,0 +1,68 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stesla/ldap/asn1"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestDelete(t *testing.T) {
+	dn := "cn=Alice Lastname,ou=users,dc=example,dc=org"
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, op := s.readRequest()
+		assert.Equal(t, asn1.ClassApplication, op.Class)
+		assert.Equal(t, 10, op.Tag)
+		assert.False(t, op.Constructed)
+		assert.Equal(t, dn, string(op.Bytes))
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:11", Value: ldapResult{
+			ResultCode: NoSuchObject,
+			MatchedDN:  []byte("ou=users,dc=example,dc=org"),
+		}})
+	})
+	defer wait()
+
+	err := conn.Delete(dn)
+	assert.True(t, errors.Is(err, NoSuchObject), "expected noSuchObject, got %v", err)
+	var rerr *ResultError
+	if assert.True(t, errors.As(err, &rerr)) {
+		assert.Equal(t, "ou=users,dc=example,dc=org", rerr.MatchedDN)
+	}
+}
+
+func TestModifyDN(t *testing.T) {
+	var tests = []struct {
+		newSuperior string
+		expected    modifyDNRequest
+	}{
+		{"", modifyDNRequest{
+			Entry:        []byte("cn=Alice Lastname,ou=users,dc=example,dc=org"),
+			NewRDN:       []byte("cn=Alice Newname"),
+			DeleteOldRDN: true,
+		}},
+		{"ou=admins,dc=example,dc=org", modifyDNRequest{
+			Entry:        []byte("cn=Alice Lastname,ou=users,dc=example,dc=org"),
+			NewRDN:       []byte("cn=Alice Newname"),
+			DeleteOldRDN: true,
+			NewSuperior:  []byte("ou=admins,dc=example,dc=org"),
+		}},
+	}
+
+	for _, test := range tests {
+		func() {
+			conn, wait := newTestConn(t, func(s *testServer) {
+				id, op := s.readRequest()
+				var req modifyDNRequest
+				if s.decodeRequest(op, "application,tag:12", &req) {
+					assert.Equal(t, test.expected, req)
+				}
+				s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:13", Value: ldapResult{}})
+			})
+			defer wait()
+
+			err := conn.ModifyDN(string(test.expected.Entry), "cn=Alice Newname", true, test.newSuperior)
+			assert.NoError(t, err)
+		}()
+	}
+}
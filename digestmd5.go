@@ -0,0 +1,256 @@
+package ldap
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+// SASLDigestMD5 returns the DIGEST-MD5 mechanism (RFC 2831), which
+// authenticates username in realm with password and acts as authzid,
+// if it is not empty. If realm is empty, the first realm offered by
+// the server is used. Host is the name of the server, used in the
+// digest-uri "ldap/host". Only authentication is supported, not
+// integrity or confidentiality protection, and the server's rspauth
+// is verified when the bind completes.
+//
+// DIGEST-MD5 is obsolete (RFC 6331) and should only be used with
+// servers that support nothing better.
+func SASLDigestMD5(authzid, username, password, realm, host string) SASLMechanism {
+	return &digestMD5Mechanism{
+		authzid:   authzid,
+		username:  username,
+		password:  password,
+		realm:     realm,
+		digestURI: "ldap/" + host,
+		newNonce:  saslNonce,
+	}
+}
+
+type digestMD5Mechanism struct {
+	authzid, username, password, realm string
+	digestURI                          string
+
+	// newNonce generates the client nonce for each exchange.
+	newNonce func() (string, error)
+
+	cnonce   string
+	rspauth  string
+	verified bool
+}
+
+func (m *digestMD5Mechanism) Start() (string, []byte, error) {
+	cnonce, err := m.newNonce()
+	if err != nil {
+		return "", nil, err
+	}
+	m.cnonce, m.rspauth, m.verified = cnonce, "", false
+	return "DIGEST-MD5", nil, nil
+}
+
+func (m *digestMD5Mechanism) Next(challenge []byte, more bool) ([]byte, error) {
+	switch {
+	case m.rspauth == "" && more:
+		return m.response(string(challenge))
+	case m.rspauth == "":
+		return nil, LDAPError{"DIGEST-MD5 bind completed before authentication"}
+	case !m.verified && len(challenge) == 0:
+		return nil, LDAPError{"DIGEST-MD5 server did not send rspauth"}
+	case !m.verified:
+		directives, _, err := digestDirectives(string(challenge))
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal([]byte(directives["rspauth"]), []byte(m.rspauth)) {
+			return nil, LDAPError{"DIGEST-MD5 server rspauth does not match"}
+		}
+		m.verified = true
+		// The server may send rspauth as a challenge, in which
+		// case it expects an empty response.
+		return []byte{}, nil
+	case more:
+		return nil, LDAPError{"unexpected challenge for DIGEST-MD5"}
+	}
+	return nil, nil
+}
+
+// response returns the digest-response to challenge, and computes the
+// rspauth expected from the server.
+func (m *digestMD5Mechanism) response(challenge string) ([]byte, error) {
+	directives, realms, err := digestDirectives(challenge)
+	if err != nil {
+		return nil, err
+	}
+	nonce := directives["nonce"]
+	if nonce == "" {
+		return nil, LDAPError{"DIGEST-MD5 challenge has no nonce"}
+	}
+	if directives["algorithm"] != "md5-sess" {
+		return nil, LDAPError{"DIGEST-MD5 challenge has unsupported algorithm " + directives["algorithm"]}
+	}
+	if qop, ok := directives["qop"]; ok && !digestListHas(qop, "auth") {
+		return nil, LDAPError{"DIGEST-MD5 server does not support authentication without a security layer"}
+	}
+	utf8Charset := directives["charset"] == "utf-8"
+
+	realm := m.realm
+	if realm == "" && len(realms) > 0 {
+		realm = realms[0]
+	}
+	const nc = "00000001"
+
+	// The username, realm and password are hashed in ISO 8859-1
+	// whenever they can be, even if the server accepts UTF-8 (RFC
+	// 2831 section 2.1.2.1).
+	secret := md5.Sum([]byte(latin1(m.username) + ":" + latin1(realm) + ":" + latin1(m.password)))
+	a1 := string(secret[:]) + ":" + nonce + ":" + m.cnonce
+	if m.authzid != "" {
+		a1 += ":" + m.authzid
+	}
+	digest := func(a2 string) string {
+		return md5Hex(md5Hex(a1) + ":" + nonce + ":" + nc + ":" + m.cnonce + ":auth:" + md5Hex(a2))
+	}
+	m.rspauth = digest(":" + m.digestURI)
+
+	var b strings.Builder
+	if utf8Charset {
+		b.WriteString("charset=utf-8,")
+	}
+	b.WriteString("username=" + digestQuote(m.username))
+	if realm != "" {
+		b.WriteString(",realm=" + digestQuote(realm))
+	}
+	b.WriteString(",nonce=" + digestQuote(nonce))
+	b.WriteString(",cnonce=" + digestQuote(m.cnonce))
+	b.WriteString(",nc=" + nc + ",qop=auth")
+	b.WriteString(",digest-uri=" + digestQuote(m.digestURI))
+	b.WriteString(",response=" + digest("AUTHENTICATE:"+m.digestURI))
+	if m.authzid != "" {
+		b.WriteString(",authzid=" + digestQuote(m.authzid))
+	}
+	return []byte(b.String()), nil
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// latin1 returns s encoded in ISO 8859-1, if it can be. Otherwise it
+// returns s.
+func latin1(s string) string {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return s
+		}
+		b = append(b, byte(r))
+	}
+	return string(b)
+}
+
+func digestQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// digestListHas reports whether the comma-separated list s contains
+// token.
+func digestListHas(s, token string) bool {
+	for _, t := range strings.Split(s, ",") {
+		if strings.TrimSpace(t) == token {
+			return true
+		}
+	}
+	return false
+}
+
+// digestDirectives parses a DIGEST-MD5 challenge into its directives.
+// The realm directive may appear more than once, so its values are
+// returned separately.
+func digestDirectives(s string) (directives map[string]string, realms []string, err error) {
+	directives = make(map[string]string)
+	invalid := LDAPError{"invalid DIGEST-MD5 challenge"}
+	for i := 0; ; {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == ',') {
+			i++
+		}
+		if i == len(s) {
+			return directives, realms, nil
+		}
+		eq := strings.IndexByte(s[i:], '=')
+		if eq < 0 {
+			return nil, nil, invalid
+		}
+		key := strings.ToLower(strings.TrimSpace(s[i : i+eq]))
+		i += eq + 1
+
+		var value string
+		if i < len(s) && s[i] == '"' {
+			var b strings.Builder
+			for i++; ; i++ {
+				if i == len(s) {
+					return nil, nil, invalid
+				}
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				} else if s[i] == '"' {
+					i++
+					break
+				}
+				b.WriteByte(s[i])
+			}
+			value = b.String()
+		} else {
+			end := strings.IndexByte(s[i:], ',')
+			if end < 0 {
+				end = len(s) - i
+			}
+			value = strings.TrimSpace(s[i : i+end])
+			i += end
+		}
+		if !utf8.ValidString(value) {
+			return nil, nil, invalid
+		}
+
+		if key == "realm" {
+			realms = append(realms, value)
+		} else {
+			directives[key] = value
+		}
+	}
+}
+
+// SASLCramMD5 returns the CRAM-MD5 mechanism (RFC 2195), which
+// authenticates username with password without sending the password
+// to the server. CRAM-MD5 does not authenticate the server.
+//
+// CRAM-MD5 is obsolete and should only be used with servers that
+// support nothing better.
+func SASLCramMD5(username, password string) SASLMechanism {
+	return &cramMD5Mechanism{username: username, password: password}
+}
+
+type cramMD5Mechanism struct {
+	username, password string
+	answered           bool
+}
+
+func (m *cramMD5Mechanism) Start() (string, []byte, error) {
+	m.answered = false
+	return "CRAM-MD5", nil, nil
+}
+
+func (m *cramMD5Mechanism) Next(challenge []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	if m.answered {
+		return nil, LDAPError{"unexpected challenge for CRAM-MD5"}
+	}
+	m.answered = true
+	mac := hmac.New(md5.New, []byte(m.password))
+	mac.Write(challenge)
+	return []byte(m.username + " " + hex.EncodeToString(mac.Sum(nil))), nil
+}
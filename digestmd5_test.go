@@ -0,0 +1,201 @@
+package ldap
+
+import (
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+// Exchanges recorded in RFC 2831 section 4.
+func TestDigestMD5Exchanges(t *testing.T) {
+	tests := []struct {
+		digestURI, cnonce string
+		challenge         string
+		response, rspauth string
+	}{
+		{
+			digestURI: "imap/elwood.innosoft.com",
+			cnonce:    "OA6MHXh6VqTrRk",
+			challenge: `realm="elwood.innosoft.com",nonce="OA6MG9tEQGm2hh",qop="auth",algorithm=md5-sess,charset=utf-8`,
+			response:  "d388dad90d4bbd760a152321f2143af7",
+			rspauth:   "rspauth=ea40f60335c427b5527b84dbabcdfffd",
+		},
+		{
+			digestURI: "acap/elwood.innosoft.com",
+			cnonce:    "OA9BSuZWMSpW8m",
+			challenge: `realm="elwood.innosoft.com",nonce="OA9BSXrbuRhWay",qop="auth",algorithm=md5-sess,charset=utf-8`,
+			response:  "6084c6db3fede7352c551284490fd0fc",
+			rspauth:   "rspauth=2f0b3d7c3c2e486600ef710726aa2eae",
+		},
+	}
+	for _, test := range tests {
+		m := SASLDigestMD5("", "chris", "secret", "", "elwood.innosoft.com").(*digestMD5Mechanism)
+		m.digestURI = test.digestURI
+		m.newNonce = fixedNonce(test.cnonce)
+
+		// The same mechanism may be used for more than one bind.
+		for i := 0; i < 2; i++ {
+			name, initial, err := m.Start()
+			assert.NoError(t, err)
+			assert.Equal(t, "DIGEST-MD5", name)
+			assert.Nil(t, initial)
+
+			resp, err := m.Next([]byte(test.challenge), true)
+			if !assert.NoError(t, err) {
+				break
+			}
+			directives, realms, err := digestDirectives(string(resp))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"elwood.innosoft.com"}, realms)
+			assert.Equal(t, map[string]string{
+				"charset":    "utf-8",
+				"username":   "chris",
+				"nonce":      directives["nonce"],
+				"cnonce":     test.cnonce,
+				"nc":         "00000001",
+				"qop":        "auth",
+				"digest-uri": test.digestURI,
+				"response":   test.response,
+			}, directives)
+
+			resp, err = m.Next([]byte(test.rspauth), true)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{}, resp)
+			_, err = m.Next(nil, false)
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestDigestMD5NoncePerExchange(t *testing.T) {
+	const challenge = `realm="elwood.innosoft.com",nonce="OA6MG9tEQGm2hh",qop="auth",algorithm=md5-sess,charset=utf-8`
+	m := SASLDigestMD5("", "chris", "secret", "", "elwood.innosoft.com")
+	var cnonces []string
+	for i := 0; i < 2; i++ {
+		_, _, err := m.Start()
+		assert.NoError(t, err)
+		resp, err := m.Next([]byte(challenge), true)
+		if !assert.NoError(t, err) {
+			return
+		}
+		directives, _, err := digestDirectives(string(resp))
+		assert.NoError(t, err)
+		cnonces = append(cnonces, directives["cnonce"])
+	}
+	assert.NotEqual(t, cnonces[0], cnonces[1])
+}
+
+func TestDigestMD5Latin1(t *testing.T) {
+	tests := []struct {
+		password, response string
+	}{
+		// Hashed as ISO 8859-1 even though the server accepts UTF-8.
+		{"m\u00fcller", "d317fb5c1c58474250b12189841d1093"},
+		// Hashed as UTF-8, since it is not ISO 8859-1.
+		{"m\u00fcller\u20ac", "ec05135aefad690d9d51d54e048bba17"},
+	}
+	for _, test := range tests {
+		m := SASLDigestMD5("", "chris", test.password, "", "elwood.innosoft.com").(*digestMD5Mechanism)
+		m.newNonce = fixedNonce("OA6MHXh6VqTrRk")
+		m.Start()
+		resp, err := m.Next([]byte(`realm="elwood.innosoft.com",nonce="OA6MG9tEQGm2hh",qop="auth",algorithm=md5-sess,charset=utf-8`), true)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		directives, _, err := digestDirectives(string(resp))
+		assert.NoError(t, err)
+		assert.Equal(t, test.response, directives["response"], test.password)
+	}
+}
+
+func TestDigestMD5AuthzidAndRealm(t *testing.T) {
+	m := SASLDigestMD5("u:admin", "chris", "secret", "example.org", "ldap.example.org").(*digestMD5Mechanism)
+	m.newNonce = fixedNonce("OA6MHXh6VqTrRk")
+	m.Start()
+	resp, err := m.Next([]byte(`realm="elwood.innosoft.com",realm="example.org",nonce="OA6MG9tEQGm2hh",algorithm=md5-sess`), true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	directives, realms, err := digestDirectives(string(resp))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.org"}, realms)
+	assert.Equal(t, "u:admin", directives["authzid"])
+	assert.Equal(t, "ldap/ldap.example.org", directives["digest-uri"])
+	assert.Equal(t, "", directives["charset"])
+}
+
+func TestDigestMD5RejectsServer(t *testing.T) {
+	const challenge = `realm="elwood.innosoft.com",nonce="OA6MG9tEQGm2hh",qop="auth",algorithm=md5-sess,charset=utf-8`
+	tests := []struct {
+		challenge, rspauth string
+	}{
+		{`realm="elwood.innosoft.com",qop="auth",algorithm=md5-sess`, ""},
+		{`nonce="OA6MG9tEQGm2hh",qop="auth"`, ""},
+		{`nonce="OA6MG9tEQGm2hh",qop="auth-conf",algorithm=md5-sess`, ""},
+		{`nonce="OA6MG9tEQGm2hh`, ""},
+		{challenge, "rspauth=00000000000000000000000000000000"},
+		{challenge, ""},
+	}
+	for _, test := range tests {
+		m := SASLDigestMD5("", "chris", "secret", "", "elwood.innosoft.com")
+		m.Start()
+		_, err := m.Next([]byte(test.challenge), true)
+		if test.challenge != challenge {
+			assert.Error(t, err, test.challenge)
+			continue
+		}
+		assert.NoError(t, err)
+		_, err = m.Next([]byte(test.rspauth), false)
+		assert.Error(t, err, test.rspauth)
+	}
+}
+
+func TestSASLBindDigestMD5(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, creds := s.readSASLBind()
+		assert.Equal(t, "DIGEST-MD5", string(creds.Mechanism))
+		assert.Nil(t, creds.Credentials)
+		s.writeBindResponse(id, SaslBindInProgress, []byte(`realm="elwood.innosoft.com",nonce="OA6MG9tEQGm2hh",qop="auth",algorithm=md5-sess,charset=utf-8`))
+
+		id, creds = s.readSASLBind()
+		directives, _, err := digestDirectives(string(creds.Credentials))
+		assert.NoError(t, err)
+		assert.Equal(t, "d388dad90d4bbd760a152321f2143af7", directives["response"])
+		s.writeBindResponse(id, SaslBindInProgress, []byte("rspauth=ea40f60335c427b5527b84dbabcdfffd"))
+
+		id, creds = s.readSASLBind()
+		assert.Equal(t, []byte{}, creds.Credentials)
+		s.writeBindResponse(id, Success, nil)
+	})
+	defer wait()
+
+	m := SASLDigestMD5("", "chris", "secret", "", "elwood.innosoft.com").(*digestMD5Mechanism)
+	m.digestURI = "imap/elwood.innosoft.com"
+	m.newNonce = fixedNonce("OA6MHXh6VqTrRk")
+	assert.NoError(t, conn.SASLBind(m))
+}
+
+// Exchange recorded in RFC 2195 section 2.
+func TestCramMD5Exchange(t *testing.T) {
+	m := SASLCramMD5("tim", "tanstaaftanstaaf")
+	name, initial, err := m.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, "CRAM-MD5", name)
+	assert.Nil(t, initial)
+
+	resp, err := m.Next([]byte("<1896.697170952@postoffice.reston.mci.net>"), true)
+	assert.NoError(t, err)
+	assert.Equal(t, "tim b913a602c7eda7a495b4e6e7334d3890", string(resp))
+
+	_, err = m.Next([]byte("again"), true)
+	assert.Error(t, err)
+	_, err = m.Next(nil, false)
+	assert.NoError(t, err)
+
+	// The same mechanism may be used for another bind.
+	_, _, err = m.Start()
+	assert.NoError(t, err)
+	resp, err = m.Next([]byte("<1896.697170952@postoffice.reston.mci.net>"), true)
+	assert.NoError(t, err)
+	assert.Equal(t, "tim b913a602c7eda7a495b4e6e7334d3890", string(resp))
+}
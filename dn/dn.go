@@ -0,0 +1,391 @@
+// Package dn parses, formats and compares LDAP distinguished names as
+// described in RFC 4514.
+package dn
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/stesla/ldap/asn1"
+)
+
+// A DN is a distinguished name. The first RDN names the entry itself
+// and the last names the entry closest to the root, so the DN
+// "cn=Alice,dc=example,dc=org" has three RDNs, starting with "cn=Alice".
+// The empty DN names the root.
+type DN []RDN
+
+// An RDN is a relative distinguished name, made of one or more
+// attribute type and value pairs. An RDN with more than one pair is
+// multi-valued, such as "cn=Alice+uid=alice".
+type RDN []AttributeTypeAndValue
+
+// AttributeTypeAndValue is one component of an RDN.
+type AttributeTypeAndValue struct {
+	Type  string
+	Value string
+
+	// BER holds the BER encoding of a value that was given in
+	// hexadecimal form ("#...") and could not be decoded as a
+	// string. If BER is set, Value is ignored.
+	BER []byte
+}
+
+// SyntaxError describes a problem parsing a DN. Offset is the byte
+// offset in the string at which the problem was found.
+type SyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("DN syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+// Parse parses the string representation of a DN, such as
+// "cn=Alice Lastname,ou=users,dc=example,dc=org". Spaces around the
+// separators are ignored.
+func Parse(s string) (DN, error) {
+	p := &parser{s: s}
+	p.skipSpaces()
+	if p.eof() {
+		return DN{}, nil
+	}
+	var dn DN
+	for {
+		rdn, err := p.rdn()
+		if err != nil {
+			return nil, err
+		}
+		dn = append(dn, rdn)
+		if p.eof() {
+			return dn, nil
+		}
+		if p.s[p.pos] != ',' {
+			return nil, p.errorf("expected ',', found %q", p.s[p.pos])
+		}
+		p.pos++
+	}
+}
+
+// ParseRDN parses the string representation of an RDN, such as
+// "cn=Alice+uid=alice".
+func ParseRDN(s string) (RDN, error) {
+	p := &parser{s: s}
+	rdn, err := p.rdn()
+	if err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q after RDN", p.s[p.pos])
+	}
+	return rdn, nil
+}
+
+// String returns the RFC 4514 string representation of dn.
+func (dn DN) String() string {
+	parts := make([]string, len(dn))
+	for i, rdn := range dn {
+		parts[i] = rdn.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// String returns the RFC 4514 string representation of rdn.
+func (rdn RDN) String() string {
+	parts := make([]string, len(rdn))
+	for i, atv := range rdn {
+		parts[i] = atv.String()
+	}
+	return strings.Join(parts, "+")
+}
+
+// String returns the RFC 4514 string representation of atv.
+func (atv AttributeTypeAndValue) String() string {
+	if atv.BER != nil {
+		return atv.Type + "=#" + hex.EncodeToString(atv.BER)
+	}
+	return atv.Type + "=" + escapeValue(atv.Value)
+}
+
+// Parent returns the DN of dn's parent, or nil if dn is the root.
+func (dn DN) Parent() DN {
+	if len(dn) == 0 {
+		return nil
+	}
+	return dn[1:]
+}
+
+// IsChildOf reports whether dn is an immediate child of parent.
+func (dn DN) IsChildOf(parent DN) bool {
+	return len(dn) == len(parent)+1 && dn[1:].Equal(parent)
+}
+
+// IsDescendantOf reports whether dn is below ancestor in the tree,
+// at any depth.
+func (dn DN) IsDescendantOf(ancestor DN) bool {
+	return len(dn) > len(ancestor) && dn[len(dn)-len(ancestor):].Equal(ancestor)
+}
+
+// Equal reports whether dn and other name the same entry. Attribute
+// types and values are compared ignoring case and insignificant
+// whitespace, and the order of the values of a multi-valued RDN does
+// not matter.
+func (dn DN) Equal(other DN) bool {
+	if len(dn) != len(other) {
+		return false
+	}
+	for i := range dn {
+		if !dn[i].Equal(other[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal reports whether rdn and other are the same, as described for
+// DN.Equal.
+func (rdn RDN) Equal(other RDN) bool {
+	if len(rdn) != len(other) {
+		return false
+	}
+	a, b := rdn.normalize(), other.normalize()
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize returns the normalized attribute type and value pairs of
+// rdn in sorted order.
+func (rdn RDN) normalize() []string {
+	n := make([]string, len(rdn))
+	for i, atv := range rdn {
+		n[i] = atv.normalize()
+	}
+	sort.Strings(n)
+	return n
+}
+
+func (atv AttributeTypeAndValue) normalize() string {
+	t := strings.ToLower(atv.Type)
+	if atv.BER != nil {
+		return t + "=#" + hex.EncodeToString(atv.BER)
+	}
+	return t + "=" + escapeValue(strings.ToLower(strings.Join(strings.Fields(atv.Value), " ")))
+}
+
+// escapeValue escapes s as an attribute value in the string form of a
+// DN (RFC 4514 section 2.4).
+func escapeValue(s string) string {
+	var b strings.Builder
+	valid := utf8.ValidString(s)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '+' || c == ',' || c == ';' || c == '<' || c == '>' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case (c == ' ' || c == '#') && i == 0, c == ' ' && i == len(s)-1:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == 0 || c >= utf8.RuneSelf && !valid:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Offset: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser) skipSpaces() {
+	for !p.eof() && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *parser) rdn() (RDN, error) {
+	var rdn RDN
+	for {
+		atv, err := p.attributeTypeAndValue()
+		if err != nil {
+			return nil, err
+		}
+		rdn = append(rdn, atv)
+		if p.eof() || p.s[p.pos] != '+' {
+			return rdn, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) attributeTypeAndValue() (atv AttributeTypeAndValue, err error) {
+	p.skipSpaces()
+	start := p.pos
+	for !p.eof() && isTypeChar(p.s[p.pos]) {
+		p.pos++
+	}
+	atv.Type = p.s[start:p.pos]
+	if !isAttributeType(atv.Type) {
+		p.pos = start
+		return atv, p.errorf("invalid attribute type %q", atv.Type)
+	}
+	p.skipSpaces()
+	if p.eof() || p.s[p.pos] != '=' {
+		return atv, p.errorf("expected '=' after attribute type")
+	}
+	p.pos++
+	p.skipSpaces()
+	if !p.eof() && p.s[p.pos] == '#' {
+		err = p.hexValue(&atv)
+	} else {
+		atv.Value, err = p.stringValue()
+	}
+	p.skipSpaces()
+	return atv, err
+}
+
+// hexValue parses a value given as the hexadecimal BER encoding of
+// the value. Values that are strings are decoded into atv.Value.
+func (p *parser) hexValue(atv *AttributeTypeAndValue) error {
+	p.pos++
+	start := p.pos
+	for !p.eof() && isHex(p.s[p.pos]) {
+		p.pos++
+	}
+	b, err := hex.DecodeString(p.s[start:p.pos])
+	if err != nil || len(b) == 0 {
+		return &SyntaxError{Offset: start, Msg: "invalid hex value"}
+	}
+
+	var v asn1.RawValue
+	r := bytes.NewReader(b)
+	if err := asn1.NewDecoder(r).Decode(&v); err != nil {
+		return &SyntaxError{Offset: start, Msg: fmt.Sprintf("invalid BER value: %v", err)}
+	}
+	if r.Len() > 0 {
+		return &SyntaxError{Offset: start, Msg: "trailing bytes after BER value"}
+	}
+	if v.Class == asn1.ClassUniversal && !v.Constructed && isStringTag(v.Tag) {
+		atv.Value = string(v.Bytes)
+	} else {
+		atv.BER = b
+	}
+	return nil
+}
+
+func isStringTag(tag int) bool {
+	switch tag {
+	case asn1.TagOctetString, asn1.TagUTF8String, asn1.TagNumericString,
+		asn1.TagPrintableString, asn1.TagT61String, asn1.TagIA5String,
+		asn1.TagVisibleString:
+		return true
+	}
+	return false
+}
+
+// stringValue parses a value in string form, ending at an unescaped
+// ',' or '+'. Unescaped trailing spaces are not part of the value.
+func (p *parser) stringValue() (string, error) {
+	var b []byte
+	trailing := 0
+	for !p.eof() {
+		c := p.s[p.pos]
+		switch c {
+		case ',', '+':
+			return string(b[:len(b)-trailing]), nil
+		case '\\':
+			p.pos++
+			if p.eof() {
+				return "", p.errorf("unexpected end of DN after '\\'")
+			}
+			if c := p.s[p.pos]; isHex(c) {
+				if p.pos+1 >= len(p.s) || !isHex(p.s[p.pos+1]) {
+					return "", p.errorf("invalid hex escape")
+				}
+				b = append(b, unhex(c)<<4|unhex(p.s[p.pos+1]))
+				p.pos += 2
+			} else if strings.IndexByte(" \"#+,;<=>\\", c) >= 0 {
+				b = append(b, c)
+				p.pos++
+			} else {
+				return "", p.errorf("invalid escape %q", c)
+			}
+			trailing = 0
+			continue
+		case '"', ';', '<', '>', 0:
+			return "", p.errorf("unescaped %q in value", c)
+		case ' ':
+			trailing++
+		default:
+			trailing = 0
+		}
+		b = append(b, c)
+		p.pos++
+	}
+	return string(b[:len(b)-trailing]), nil
+}
+
+func isTypeChar(c byte) bool {
+	return isAlpha(c) || isDigit(c) || c == '-' || c == '.'
+}
+
+// isAttributeType reports whether s is a descr or numericoid (RFC
+// 4512 section 1.4).
+func isAttributeType(s string) bool {
+	if s == "" {
+		return false
+	}
+	if isAlpha(s[0]) {
+		for i := 1; i < len(s); i++ {
+			if c := s[i]; !isAlpha(c) && !isDigit(c) && c != '-' {
+				return false
+			}
+		}
+		return true
+	}
+	for _, part := range strings.Split(s, ".") {
+		if part == "" || len(part) > 1 && part[0] == '0' {
+			return false
+		}
+		for i := 0; i < len(part); i++ {
+			if !isDigit(part[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isAlpha(c byte) bool { return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' }
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+func isHex(c byte) bool   { return isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F' }
+
+func unhex(c byte) byte {
+	switch {
+	case isDigit(c):
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
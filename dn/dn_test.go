@@ -0,0 +1,213 @@
+package dn
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in  string
+		out DN
+	}{
+		{"", DN{}},
+		{"cn=Alice Lastname,ou=users,dc=example,dc=org", DN{
+			{{Type: "cn", Value: "Alice Lastname"}},
+			{{Type: "ou", Value: "users"}},
+			{{Type: "dc", Value: "example"}},
+			{{Type: "dc", Value: "org"}},
+		}},
+		{"cn = Alice , ou=users", DN{
+			{{Type: "cn", Value: "Alice"}},
+			{{Type: "ou", Value: "users"}},
+		}},
+		{"cn=Alice+uid=alice,dc=org", DN{
+			{{Type: "cn", Value: "Alice"}, {Type: "uid", Value: "alice"}},
+			{{Type: "dc", Value: "org"}},
+		}},
+		{`cn=Lastname\, Alice\+\"\\\<\>\;`, DN{
+			{{Type: "cn", Value: `Lastname, Alice+"\<>;`}},
+		}},
+		{`cn=\ \#leading and trailing\ `, DN{
+			{{Type: "cn", Value: ` #leading and trailing `}},
+		}},
+		{`cn=Lu\C4\8Di\C4\87`, DN{{{Type: "cn", Value: "Lučić"}}}},
+		{"cn=a=b#c", DN{{{Type: "cn", Value: "a=b#c"}}}},
+		{"cn=", DN{{{Type: "cn", Value: ""}}}},
+		{"2.5.4.3=#04024869", DN{{{Type: "2.5.4.3", Value: "Hi"}}}},
+		{"1.3.6.1.4.1.1466.0=#0c024869", DN{{{Type: "1.3.6.1.4.1.1466.0", Value: "Hi"}}}},
+		{"x=#020101", DN{{{Type: "x", BER: []byte{0x02, 0x01, 0x01}}}}},
+	}
+	for _, test := range tests {
+		dn, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q: %v", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(dn, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, dn)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		in     string
+		offset int
+	}{
+		{"cn", 2},
+		{"=Alice", 0},
+		{"cn=Alice,", 9},
+		{"cn=Alice,,dc=org", 9},
+		{"1cn=Alice", 0},
+		{"1.02=x", 0},
+		{`cn=a\`, 5},
+		{`cn=a\q`, 5},
+		{`cn=a\4`, 5},
+		{`cn=a;dc=org`, 4},
+		{`cn=a"b`, 4},
+		{"cn=#", 4},
+		{"cn=#123", 4},
+		{"cn=#0402", 4},
+		{"cn=#0402486969", 4},
+		{"cn=a+", 5},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.in)
+		e, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("%q: expected *SyntaxError got %v", test.in, err)
+			continue
+		}
+		if e.Offset != test.offset {
+			t.Errorf("%q: expected offset %d got %d (%v)", test.in, test.offset, e.Offset, e)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in  DN
+		out string
+	}{
+		{DN{}, ""},
+		{DN{
+			{{Type: "cn", Value: "Alice"}, {Type: "uid", Value: "alice"}},
+			{{Type: "dc", Value: "org"}},
+		}, "cn=Alice+uid=alice,dc=org"},
+		{DN{{{Type: "cn", Value: `Lastname, Alice+"\<>;`}}}, `cn=Lastname\, Alice\+\"\\\<\>\;`},
+		{DN{{{Type: "cn", Value: " #a b "}}}, `cn=\ #a b\ `},
+		{DN{{{Type: "cn", Value: "#a"}}}, `cn=\#a`},
+		{DN{{{Type: "cn", Value: "Lučić"}}}, "cn=Lučić"},
+		{DN{{{Type: "cn", Value: "\xff\x00"}}}, `cn=\ff\00`},
+		{DN{{{Type: "x", BER: []byte{0x02, 0x01, 0x01}}}}, "x=#020101"},
+	}
+	for _, test := range tests {
+		if s := test.in.String(); s != test.out {
+			t.Errorf("%#v: expected %q got %q", test.in, test.out, s)
+			continue
+		}
+		dn, err := Parse(test.out)
+		if err != nil {
+			t.Errorf("%q: %v", test.out, err)
+		} else if !reflect.DeepEqual(dn, test.in) {
+			t.Errorf("%q: round trip expected %#v got %#v", test.out, test.in, dn)
+		}
+	}
+}
+
+func TestParseRDN(t *testing.T) {
+	rdn, err := ParseRDN("cn=Alice+uid=alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := RDN{{Type: "cn", Value: "Alice"}, {Type: "uid", Value: "alice"}}
+	if !reflect.DeepEqual(rdn, expected) {
+		t.Errorf("expected %#v got %#v", expected, rdn)
+	}
+	if _, err := ParseRDN("cn=Alice,dc=org"); err == nil {
+		t.Error("expected an error for a DN with two RDNs")
+	}
+}
+
+func mustParse(t *testing.T, s string) DN {
+	dn, err := Parse(s)
+	if err != nil {
+		t.Fatalf("%q: %v", s, err)
+	}
+	return dn
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"", "", true},
+		{"cn=Alice,dc=org", "CN=alice, DC=ORG", true},
+		{"cn=Alice  Lastname,dc=org", "cn=alice lastname,dc=org", true},
+		{"cn=Alice+uid=alice,dc=org", "UID=Alice+cn=alice,dc=org", true},
+		{"cn=Hi", "cn=#04024869", true},
+		{"cn=Alice,dc=org", "cn=Bob,dc=org", false},
+		{"cn=Alice,dc=org", "cn=Alice", false},
+		{"cn=Alice+uid=alice", "cn=Alice", false},
+		{"cn=Alice+uid=alice", "cn=Alice+sn=alice", false},
+		{`cn=a\,b`, `cn=a\2cb`, true},
+		{`cn=a\,b,dc=org`, `cn=a,b=dc,dc=org`, false},
+		{"x=#020101", "x=#020101", true},
+		{"x=#020101", "x=#020102", false},
+	}
+	for _, test := range tests {
+		a, b := mustParse(t, test.a), mustParse(t, test.b)
+		if eq := a.Equal(b); eq != test.equal {
+			t.Errorf("%q == %q: expected %v got %v", test.a, test.b, test.equal, eq)
+		}
+		if eq := b.Equal(a); eq != test.equal {
+			t.Errorf("%q == %q: expected %v got %v", test.b, test.a, test.equal, eq)
+		}
+	}
+}
+
+func TestHierarchy(t *testing.T) {
+	alice := mustParse(t, "cn=Alice,ou=Users,dc=example,dc=org")
+	users := mustParse(t, "OU=users,dc=Example,dc=org")
+	org := mustParse(t, "dc=org")
+	root := mustParse(t, "")
+
+	if parent := alice.Parent(); !parent.Equal(users) {
+		t.Errorf("expected parent %v got %v", users, parent)
+	}
+	if parent := root.Parent(); parent != nil {
+		t.Errorf("expected root to have no parent, got %v", parent)
+	}
+
+	tests := []struct {
+		dn, other         DN
+		child, descendant bool
+	}{
+		{alice, users, true, true},
+		{alice, org, false, true},
+		{alice, root, false, true},
+		{org, root, true, true},
+		{users, alice, false, false},
+		{alice, alice, false, false},
+		{root, root, false, false},
+		{alice, mustParse(t, "ou=Groups,dc=example,dc=org"), false, false},
+	}
+	for _, test := range tests {
+		if child := test.dn.IsChildOf(test.other); child != test.child {
+			t.Errorf("%v IsChildOf %v: expected %v got %v", test.dn, test.other, test.child, child)
+		}
+		if descendant := test.dn.IsDescendantOf(test.other); descendant != test.descendant {
+			t.Errorf("%v IsDescendantOf %v: expected %v got %v", test.dn, test.other, test.descendant, descendant)
+		}
+	}
+}
+
+func TestHexValueKeepsNonStrings(t *testing.T) {
+	dn := mustParse(t, "x=#3003020101")
+	if ber := dn[0][0].BER; !bytes.Equal(ber, []byte{0x30, 0x03, 0x02, 0x01, 0x01}) {
+		t.Errorf("unexpected BER %x", ber)
+	}
+}
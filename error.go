@@ -1,5 +1,7 @@
 package ldap
 
+import "fmt"
+
 type LDAPError struct {
 	Msg string
 }
@@ -7,3 +9,136 @@ type LDAPError struct {
 func (e LDAPError) Error() string { return "LDAP error: " + e.Msg }
 
 var notimpl = LDAPError{"Not Implemented"}
+
+// ResultCode is the resultCode of an LDAPResult, as defined in RFC
+// 4511 section 4.1.9. It implements error so that it can be used as
+// the target of errors.Is.
+type ResultCode int16
+
+const (
+	Success                      ResultCode = 0
+	OperationsError              ResultCode = 1
+	ProtocolError                ResultCode = 2
+	TimeLimitExceeded            ResultCode = 3
+	SizeLimitExceeded            ResultCode = 4
+	CompareFalse                 ResultCode = 5
+	CompareTrue                  ResultCode = 6
+	AuthMethodNotSupported       ResultCode = 7
+	StrongerAuthRequired         ResultCode = 8
+	Referral                     ResultCode = 10
+	AdminLimitExceeded           ResultCode = 11
+	UnavailableCriticalExtension ResultCode = 12
+	ConfidentialityRequired      ResultCode = 13
+	SaslBindInProgress           ResultCode = 14
+	NoSuchAttribute              ResultCode = 16
+	UndefinedAttributeType       ResultCode = 17
+	InappropriateMatching        ResultCode = 18
+	ConstraintViolation          ResultCode = 19
+	AttributeOrValueExists       ResultCode = 20
+	InvalidAttributeSyntax       ResultCode = 21
+	NoSuchObject                 ResultCode = 32
+	AliasProblem                 ResultCode = 33
+	InvalidDNSyntax              ResultCode = 34
+	AliasDereferencingProblem    ResultCode = 36
+	InappropriateAuthentication  ResultCode = 48
+	InvalidCredentials           ResultCode = 49
+	InsufficientAccessRights     ResultCode = 50
+	Busy                         ResultCode = 51
+	Unavailable                  ResultCode = 52
+	UnwillingToPerform           ResultCode = 53
+	LoopDetect                   ResultCode = 54
+	SortControlMissing           ResultCode = 60 // VLV
+	OffsetRangeError             ResultCode = 61 // VLV
+	NamingViolation              ResultCode = 64
+	ObjectClassViolation         ResultCode = 65
+	NotAllowedOnNonLeaf          ResultCode = 66
+	NotAllowedOnRDN              ResultCode = 67
+	EntryAlreadyExists           ResultCode = 68
+	ObjectClassModsProhibited    ResultCode = 69
+	AffectsMultipleDSAs          ResultCode = 71
+	Other                        ResultCode = 80
+)
+
+var resultCodeNames = map[ResultCode]string{
+	Success:                      "success",
+	OperationsError:              "operationsError",
+	ProtocolError:                "protocolError",
+	TimeLimitExceeded:            "timeLimitExceeded",
+	SizeLimitExceeded:            "sizeLimitExceeded",
+	CompareFalse:                 "compareFalse",
+	CompareTrue:                  "compareTrue",
+	AuthMethodNotSupported:       "authMethodNotSupported",
+	StrongerAuthRequired:         "strongerAuthRequired",
+	Referral:                     "referral",
+	AdminLimitExceeded:           "adminLimitExceeded",
+	UnavailableCriticalExtension: "unavailableCriticalExtension",
+	ConfidentialityRequired:      "confidentialityRequired",
+	SaslBindInProgress:           "saslBindInProgress",
+	NoSuchAttribute:              "noSuchAttribute",
+	UndefinedAttributeType:       "undefinedAttributeType",
+	InappropriateMatching:        "inappropriateMatching",
+	ConstraintViolation:          "constraintViolation",
+	AttributeOrValueExists:       "attributeOrValueExists",
+	InvalidAttributeSyntax:       "invalidAttributeSyntax",
+	NoSuchObject:                 "noSuchObject",
+	AliasProblem:                 "aliasProblem",
+	InvalidDNSyntax:              "invalidDNSyntax",
+	AliasDereferencingProblem:    "aliasDereferencingProblem",
+	InappropriateAuthentication:  "inappropriateAuthentication",
+	InvalidCredentials:           "invalidCredentials",
+	InsufficientAccessRights:     "insufficientAccessRights",
+	Busy:                         "busy",
+	Unavailable:                  "unavailable",
+	UnwillingToPerform:           "unwillingToPerform",
+	LoopDetect:                   "loopDetect",
+	SortControlMissing:           "sortControlMissing",
+	OffsetRangeError:             "offsetRangeError",
+	NamingViolation:              "namingViolation",
+	ObjectClassViolation:         "objectClassViolation",
+	NotAllowedOnNonLeaf:          "notAllowedOnNonLeaf",
+	NotAllowedOnRDN:              "notAllowedOnRDN",
+	EntryAlreadyExists:           "entryAlreadyExists",
+	ObjectClassModsProhibited:    "objectClassModsProhibited",
+	AffectsMultipleDSAs:          "affectsMultipleDSAs",
+	Other:                        "other",
+}
+
+func (c ResultCode) String() string {
+	if name, ok := resultCodeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("ResultCode(%d)", int(c))
+}
+
+func (c ResultCode) Error() string {
+	return fmt.Sprintf("LDAP error: %s (%d)", c.String(), int(c))
+}
+
+// Result is the LDAPResult with which the server completes an
+// operation.
+type Result struct {
+	ResultCode ResultCode
+	MatchedDN  string
+	Message    string
+	Referral   []string
+}
+
+// ResultError is returned when the server completes an operation with
+// a result code that indicates failure.
+type ResultError struct {
+	Result
+}
+
+func (e *ResultError) Error() string {
+	if e.Message == "" {
+		return e.ResultCode.Error()
+	}
+	return e.ResultCode.Error() + ": " + e.Message
+}
+
+// Is reports whether target is the same ResultCode as e, so that
+// errors.Is(err, ldap.NoSuchObject) works.
+func (e *ResultError) Is(target error) bool {
+	code, ok := target.(ResultCode)
+	return ok && code == e.ResultCode
+}
@@ -0,0 +1,35 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestResultCodeString(t *testing.T) {
+	assert.Equal(t, "noSuchObject", NoSuchObject.String())
+	assert.Equal(t, "insufficientAccessRights", InsufficientAccessRights.String())
+	assert.Equal(t, "ResultCode(99)", ResultCode(99).String())
+}
+
+func TestResultError(t *testing.T) {
+	r := ldapResult{
+		ResultCode: Referral,
+		Message:    []byte("go elsewhere"),
+		Referral:   [][]byte{[]byte("ldap://ldap.example.org/dc=example,dc=org")},
+	}
+	err := fmt.Errorf("wrapped: %w", r.err())
+
+	assert.Equal(t, "wrapped: LDAP error: referral (10): go elsewhere", err.Error())
+	assert.True(t, errors.Is(err, Referral))
+	assert.False(t, errors.Is(err, NoSuchObject))
+
+	var rerr *ResultError
+	if assert.True(t, errors.As(err, &rerr)) {
+		assert.Equal(t, []string{"ldap://ldap.example.org/dc=example,dc=org"}, rerr.Referral)
+	}
+
+	assert.Nil(t, (&ldapResult{ResultCode: Success}).err())
+}
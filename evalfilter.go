@@ -0,0 +1,408 @@
+package ldap
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/stesla/ldap/dn"
+)
+
+// Entry is a directory entry that a Filter can be evaluated against
+// with Match. SearchResult is an Entry.
+type Entry interface {
+	// EntryDN returns the entry's distinguished name.
+	EntryDN() string
+
+	// EntryAttributes returns the entry's attributes, keyed by
+	// attribute description.
+	EntryAttributes() map[string][]string
+}
+
+func (r SearchResult) EntryDN() string {
+	return r.DN
+}
+
+func (r SearchResult) EntryAttributes() map[string][]string {
+	return r.Attributes
+}
+
+// Match reports whether e matches f. Filters are evaluated with the
+// three-valued logic of RFC 4511 section 4.5.1.7, and e matches only
+// if f evaluates to TRUE.
+//
+// Attribute descriptions are compared case-insensitively, and a
+// filter on an attribute without options also matches its subtypes
+// with options, such as "cn;lang-en" for "cn". Values are compared
+// with the equality, ordering or substrings rule of the attribute's
+// type where the type is known, and with caseIgnore rules otherwise.
+func (f Filter) Match(e Entry) bool {
+	return f.evaluate(e) == filterTrue
+}
+
+type filterResult int
+
+const (
+	filterFalse filterResult = iota
+	filterTrue
+	filterUndefined
+)
+
+func (f Filter) evaluate(e Entry) filterResult {
+	switch f.choice {
+	case filterAnd:
+		result := filterTrue
+		for _, g := range f.filters {
+			switch g.evaluate(e) {
+			case filterFalse:
+				return filterFalse
+			case filterUndefined:
+				result = filterUndefined
+			}
+		}
+		return result
+	case filterOr:
+		result := filterFalse
+		for _, g := range f.filters {
+			switch g.evaluate(e) {
+			case filterTrue:
+				return filterTrue
+			case filterUndefined:
+				result = filterUndefined
+			}
+		}
+		return result
+	case filterNot:
+		switch f.filters[0].evaluate(e) {
+		case filterTrue:
+			return filterFalse
+		case filterFalse:
+			return filterTrue
+		}
+		return filterUndefined
+	case filterEqualityMatch, filterApproxMatch:
+		// Approximate matching is implementation-defined, so we
+		// fall back to equality as RFC 4511 allows.
+		rule := equalityRule(f.attribute)
+		return rule.match(attributeValues(e, f.attribute, false), f.value, func(c int) bool { return c == 0 })
+	case filterGreaterOrEqual:
+		rule := equalityRule(f.attribute)
+		return rule.match(attributeValues(e, f.attribute, false), f.value, func(c int) bool { return c >= 0 })
+	case filterLessOrEqual:
+		rule := equalityRule(f.attribute)
+		return rule.match(attributeValues(e, f.attribute, false), f.value, func(c int) bool { return c <= 0 })
+	case filterSubstrings:
+		rule := equalityRule(f.attribute)
+		return rule.matchSubstrings(attributeValues(e, f.attribute, false), f.substrings)
+	case filterPresent:
+		if len(attributeValues(e, f.attribute, false)) > 0 {
+			return filterTrue
+		}
+		return filterFalse
+	case filterExtensibleMatch:
+		return f.evaluateExtensible(e)
+	}
+	return filterUndefined
+}
+
+func (f Filter) evaluateExtensible(e Entry) filterResult {
+	if f.rule == "" {
+		if f.attribute == "" {
+			return filterUndefined
+		}
+		rule := equalityRule(f.attribute)
+		return rule.match(attributeValues(e, f.attribute, f.dnAttributes), f.value, func(c int) bool { return c == 0 })
+	}
+
+	rule, ok := extensibleRules[strings.ToLower(f.rule)]
+	if !ok {
+		return filterUndefined
+	}
+	test := func(c int) bool { return c == 0 }
+	if rule.ordering {
+		test = func(c int) bool { return c < 0 }
+	}
+	if f.attribute != "" {
+		return rule.match(attributeValues(e, f.attribute, f.dnAttributes), f.value, test)
+	}
+
+	// Without an attribute, the rule applies to every attribute in
+	// the entry.
+	var values []string
+	for _, vals := range e.EntryAttributes() {
+		values = append(values, vals...)
+	}
+	if f.dnAttributes {
+		for _, vals := range dnAttributeValues(e.EntryDN()) {
+			values = append(values, vals...)
+		}
+	}
+	return rule.match(values, f.value, test)
+}
+
+// attributeValues returns the values of the attribute named by desc
+// and its subtypes. If withDN is set, it includes the values of the
+// attribute in e's DN.
+func attributeValues(e Entry, desc string, withDN bool) []string {
+	var values []string
+	for d, vals := range e.EntryAttributes() {
+		if describes(desc, d) {
+			values = append(values, vals...)
+		}
+	}
+	if withDN {
+		for d, vals := range dnAttributeValues(e.EntryDN()) {
+			if describes(desc, d) {
+				values = append(values, vals...)
+			}
+		}
+	}
+	return values
+}
+
+// describes reports whether the attribute description desc, which
+// may have options, describes the attribute d: they must have the same
+// type, and d must have all of desc's options.
+func describes(desc, d string) bool {
+	want := strings.Split(strings.ToLower(desc), ";")
+	have := strings.Split(strings.ToLower(d), ";")
+	if canonicalType(want[0]) != canonicalType(have[0]) {
+		return false
+	}
+outer:
+	for _, opt := range want[1:] {
+		for _, o := range have[1:] {
+			if opt == o {
+				continue outer
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// dnAttributeValues returns the attribute values of the RDNs of the
+// DN s. It returns nothing if s is not a valid DN.
+func dnAttributeValues(s string) map[string][]string {
+	name, err := dn.Parse(s)
+	if err != nil {
+		return nil
+	}
+	attrs := make(map[string][]string)
+	for _, rdn := range name {
+		for _, atv := range rdn {
+			if atv.BER == nil {
+				attrs[atv.Type] = append(attrs[atv.Type], atv.Value)
+			}
+		}
+	}
+	return attrs
+}
+
+// matchingRule compares attribute values with an assertion value.
+type matchingRule struct {
+	// prepare normalizes a value for equality and ordering
+	// matching. It reports false if the value is not valid for the
+	// rule's syntax.
+	prepare func(string) (string, bool)
+
+	// compare orders two prepared values.
+	compare func(a, b string) int
+
+	// fold normalizes values and substrings for substrings
+	// matching. It is nil if the rule has no substrings rule.
+	fold func(string) string
+}
+
+var (
+	caseIgnoreRule = &matchingRule{
+		prepare: func(s string) (string, bool) { return strings.ToLower(collapseSpaces(s)), true },
+		compare: strings.Compare,
+		fold:    strings.ToLower,
+	}
+	caseExactRule = &matchingRule{
+		prepare: func(s string) (string, bool) { return collapseSpaces(s), true },
+		compare: strings.Compare,
+		fold:    func(s string) string { return s },
+	}
+	octetStringRule = &matchingRule{
+		prepare: func(s string) (string, bool) { return s, true },
+		compare: strings.Compare,
+	}
+	integerRule = &matchingRule{
+		prepare: prepareInteger,
+		compare: compareIntegers,
+	}
+)
+
+// collapseSpaces removes leading and trailing spaces from s and
+// replaces each run of inner spaces with a single space, as in the
+// insignificant space handling of RFC 4518.
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func prepareInteger(s string) (string, bool) {
+	n, ok := new(big.Int).SetString(strings.TrimSpace(s), 10)
+	if !ok {
+		return "", false
+	}
+	return n.String(), true
+}
+
+func compareIntegers(a, b string) int {
+	x, _ := new(big.Int).SetString(a, 10)
+	y, _ := new(big.Int).SetString(b, 10)
+	return x.Cmp(y)
+}
+
+// match returns TRUE if test is true of the comparison of any of
+// values with assertion, and UNDEFINED if assertion is not valid for
+// the rule's syntax. Values that are not valid never match.
+func (r *matchingRule) match(values []string, assertion string, test func(int) bool) filterResult {
+	a, ok := r.prepare(assertion)
+	if !ok {
+		return filterUndefined
+	}
+	for _, v := range values {
+		if v, ok := r.prepare(v); ok && test(r.compare(v, a)) {
+			return filterTrue
+		}
+	}
+	return filterFalse
+}
+
+func (r *matchingRule) matchSubstrings(values []string, substrings []substring) filterResult {
+	if r.fold == nil {
+		return filterUndefined
+	}
+	for _, v := range values {
+		if r.matchesSubstrings(r.fold(v), substrings) {
+			return filterTrue
+		}
+	}
+	return filterFalse
+}
+
+func (r *matchingRule) matchesSubstrings(v string, substrings []substring) bool {
+	for _, s := range substrings {
+		sub := r.fold(s.value)
+		switch s.kind {
+		case substringInitial:
+			if !strings.HasPrefix(v, sub) {
+				return false
+			}
+			v = v[len(sub):]
+		case substringAny:
+			i := strings.Index(v, sub)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(sub):]
+		case substringFinal:
+			if !strings.HasSuffix(v, sub) {
+				return false
+			}
+			v = v[:len(v)-len(sub)]
+		}
+	}
+	return true
+}
+
+// extensibleRule is a matching rule that can be named in an
+// extensible match filter. An ordering rule matches values that are
+// less than the assertion value.
+type extensibleRule struct {
+	*matchingRule
+	ordering bool
+}
+
+var extensibleRules = map[string]extensibleRule{}
+
+func init() {
+	for _, r := range []struct {
+		names []string
+		rule  extensibleRule
+	}{
+		{[]string{"caseIgnoreMatch", "2.5.13.2"}, extensibleRule{caseIgnoreRule, false}},
+		{[]string{"caseIgnoreOrderingMatch", "2.5.13.3"}, extensibleRule{caseIgnoreRule, true}},
+		{[]string{"caseExactMatch", "2.5.13.5"}, extensibleRule{caseExactRule, false}},
+		{[]string{"caseExactOrderingMatch", "2.5.13.6"}, extensibleRule{caseExactRule, true}},
+		{[]string{"integerMatch", "2.5.13.14"}, extensibleRule{integerRule, false}},
+		{[]string{"integerOrderingMatch", "2.5.13.15"}, extensibleRule{integerRule, true}},
+		{[]string{"octetStringMatch", "2.5.13.17"}, extensibleRule{octetStringRule, false}},
+		{[]string{"octetStringOrderingMatch", "2.5.13.18"}, extensibleRule{octetStringRule, true}},
+		{[]string{"caseExactIA5Match", "1.3.6.1.4.1.1466.109.114.1"}, extensibleRule{caseExactRule, false}},
+		{[]string{"caseIgnoreIA5Match", "1.3.6.1.4.1.1466.109.114.2"}, extensibleRule{caseIgnoreRule, false}},
+	} {
+		for _, name := range r.names {
+			extensibleRules[strings.ToLower(name)] = r.rule
+		}
+	}
+}
+
+// attributeType is the schema we know for an attribute type. Names
+// are lowercase.
+type attributeType struct {
+	name     string
+	equality *matchingRule
+}
+
+var attributeTypes = map[string]attributeType{}
+
+func init() {
+	for _, t := range []struct {
+		names    []string
+		equality *matchingRule
+	}{
+		{[]string{"cn", "commonName", "2.5.4.3"}, caseIgnoreRule},
+		{[]string{"sn", "surname", "2.5.4.4"}, caseIgnoreRule},
+		{[]string{"c", "countryName", "2.5.4.6"}, caseIgnoreRule},
+		{[]string{"l", "localityName", "2.5.4.7"}, caseIgnoreRule},
+		{[]string{"st", "stateOrProvinceName", "2.5.4.8"}, caseIgnoreRule},
+		{[]string{"o", "organizationName", "2.5.4.10"}, caseIgnoreRule},
+		{[]string{"ou", "organizationalUnitName", "2.5.4.11"}, caseIgnoreRule},
+		{[]string{"uid", "userid", "0.9.2342.19200300.100.1.1"}, caseIgnoreRule},
+		{[]string{"mail", "rfc822Mailbox", "0.9.2342.19200300.100.1.3"}, caseIgnoreRule},
+		{[]string{"dc", "domainComponent", "0.9.2342.19200300.100.1.25"}, caseIgnoreRule},
+		{[]string{"userPassword", "2.5.4.35"}, octetStringRule},
+		{[]string{"uidNumber", "1.3.6.1.1.1.1.0"}, integerRule},
+		{[]string{"gidNumber", "1.3.6.1.1.1.1.1"}, integerRule},
+		{[]string{"homeDirectory", "1.3.6.1.1.1.1.3"}, caseExactRule},
+		{[]string{"loginShell", "1.3.6.1.1.1.1.4"}, caseExactRule},
+		{[]string{"shadowLastChange", "1.3.6.1.1.1.1.5"}, integerRule},
+		{[]string{"shadowMin", "1.3.6.1.1.1.1.6"}, integerRule},
+		{[]string{"shadowMax", "1.3.6.1.1.1.1.7"}, integerRule},
+		{[]string{"shadowWarning", "1.3.6.1.1.1.1.8"}, integerRule},
+		{[]string{"shadowInactive", "1.3.6.1.1.1.1.9"}, integerRule},
+		{[]string{"shadowExpire", "1.3.6.1.1.1.1.10"}, integerRule},
+		{[]string{"shadowFlag", "1.3.6.1.1.1.1.11"}, integerRule},
+		{[]string{"memberUid", "1.3.6.1.1.1.1.12"}, caseExactRule},
+		{[]string{"ipServicePort", "1.3.6.1.1.1.1.15"}, integerRule},
+		{[]string{"ipProtocolNumber", "1.3.6.1.1.1.1.17"}, integerRule},
+		{[]string{"oncRpcNumber", "1.3.6.1.1.1.1.18"}, integerRule},
+	} {
+		canonical := strings.ToLower(t.names[0])
+		for _, name := range t.names {
+			attributeTypes[strings.ToLower(name)] = attributeType{canonical, t.equality}
+		}
+	}
+}
+
+// canonicalType returns the lowercase canonical name of the attribute
+// type named by the lowercase name.
+func canonicalType(name string) string {
+	if t, ok := attributeTypes[name]; ok {
+		return t.name
+	}
+	return name
+}
+
+// equalityRule returns the matching rule for the attribute
+// description desc, which is caseIgnore for unknown types.
+func equalityRule(desc string) *matchingRule {
+	name := strings.ToLower(strings.SplitN(desc, ";", 2)[0])
+	if t, ok := attributeTypes[name]; ok {
+		return t.equality
+	}
+	return caseIgnoreRule
+}
@@ -0,0 +1,84 @@
+package ldap
+
+import "testing"
+
+func TestFilterMatch(t *testing.T) {
+	entry := SearchResult{
+		DN: "uid=alice,ou=People+l=Earth,dc=example,dc=com",
+		Attributes: map[string][]string{
+			"objectClass":   {"top", "posixAccount"},
+			"CN":            {"Alice  Liddell"},
+			"cn;lang-fr":    {"Alice au pays"},
+			"uidNumber":     {"1001"},
+			"loginShell":    {"/bin/Bash"},
+			"userPassword":  {"secret"},
+			"description":   {"Curiouser and curiouser"},
+			"shadowExpire":  {"-1"},
+			"homeDirectory": {"/home/alice"},
+		},
+	}
+
+	tests := []struct {
+		filter string
+		result filterResult
+	}{
+		{"(&)", filterTrue},
+		{"(|)", filterFalse},
+		{"(objectclass=POSIXACCOUNT)", filterTrue},
+		{"(cn=alice liddell)", filterTrue},
+		{"(commonName= ALICE LIDDELL )", filterTrue},
+		{"(cn=alice au pays)", filterTrue},
+		{"(cn;lang-fr=alice liddell)", filterFalse},
+		{"(cn;lang-fr=alice au pays)", filterTrue},
+		{"(cn=bob)", filterFalse},
+		{"(loginShell=/bin/bash)", filterFalse},
+		{"(loginShell=/bin/Bash)", filterTrue},
+		{"(uidNumber=01001)", filterTrue},
+		{"(uidNumber>=1000)", filterTrue},
+		{"(uidNumber>=10000)", filterFalse},
+		{"(uidNumber<=999)", filterFalse},
+		{"(shadowExpire<=0)", filterTrue},
+		{"(uidNumber=abc)", filterUndefined},
+		{"(uidNumber~=1001)", filterTrue},
+		{"(cn>=B)", filterFalse},
+		{"(cn<=B)", filterTrue},
+		{"(description=*CURIOUSER*curiouser)", filterTrue},
+		{"(description=curiouser*and*and*)", filterFalse},
+		{"(description=*and)", filterFalse},
+		{"(uidNumber=10*)", filterUndefined},
+		{"(mail=*)", filterFalse},
+		{"(MAIL=alice@example.com)", filterFalse},
+		{"(UID=*)", filterFalse},
+		{"(userPassword=secret)", filterTrue},
+		{"(userPassword=Secret)", filterFalse},
+		{"(cn:caseExactMatch:=Alice Liddell)", filterTrue},
+		{"(cn:caseExactMatch:=alice liddell)", filterFalse},
+		{"(cn:2.5.13.2:=alice liddell)", filterTrue},
+		{"(uidNumber:integerOrderingMatch:=2000)", filterTrue},
+		{"(:integerMatch:=1001)", filterTrue},
+		{"(cn:unknownMatch:=x)", filterUndefined},
+		{"(uid=alice)", filterFalse},
+		{"(uid:dn:=alice)", filterTrue},
+		{"(l:dn:=earth)", filterTrue},
+		{"(:dn:caseExactMatch:=People)", filterTrue},
+		{"(:caseExactMatch:=People)", filterFalse},
+		{"(!(cn=bob))", filterTrue},
+		{"(!(uidNumber=abc))", filterUndefined},
+		{"(&(cn=alice liddell)(uidNumber=abc))", filterUndefined},
+		{"(&(cn=bob)(uidNumber=abc))", filterFalse},
+		{"(|(cn=bob)(uidNumber=abc))", filterUndefined},
+		{"(|(cn=alice liddell)(uidNumber=abc))", filterTrue},
+	}
+	for _, test := range tests {
+		f, err := ParseFilter(test.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", test.filter, err)
+		}
+		if result := f.evaluate(entry); result != test.result {
+			t.Errorf("%s: expected %v got %v", test.filter, test.result, result)
+		}
+		if match := f.Match(entry); match != (test.result == filterTrue) {
+			t.Errorf("%s: Match returned %v", test.filter, match)
+		}
+	}
+}
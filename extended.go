@@ -0,0 +1,123 @@
+package ldap
+
+import (
+	"context"
+	"strings"
+
+	"github.com/stesla/ldap/asn1"
+)
+
+// ExtendedResponse is the response to an extended operation.
+type ExtendedResponse struct {
+	// Name is the OID of the response. Many operations leave it
+	// out.
+	Name  string
+	Value []byte
+}
+
+// Extended performs the extended operation (RFC 4511 section 4.12)
+// named by oid, sending value if it is not nil.
+func (l *conn) Extended(oid string, value []byte) (*ExtendedResponse, error) {
+	return l.ExtendedContext(context.Background(), oid, value)
+}
+
+func (l *conn) ExtendedContext(ctx context.Context, oid string, value []byte) (*ExtendedResponse, error) {
+	resp, _, err := l.extended(ctx, oid, value, nil, nil)
+	return resp, err
+}
+
+// ExtendedWithControls is like ExtendedContext, but sends controls
+// with the request and returns the controls from the response, even
+// if the operation fails.
+func (l *conn) ExtendedWithControls(ctx context.Context, oid string, value []byte, controls []Control) (*ExtendedResponse, []Control, error) {
+	return l.extended(ctx, oid, value, nil, controls)
+}
+
+// extended performs an extended operation. If pause is not nil, the
+// reader stops after receiving the response until pause is closed.
+func (l *conn) extended(ctx context.Context, oid string, value []byte, pause chan struct{}, controls []Control) (*ExtendedResponse, []Control, error) {
+	encoded, err := encodeControls(controls)
+	if err != nil {
+		return nil, nil, err
+	}
+	req := extendedRequest{Name: []byte(oid), Value: value}
+	op, err := l.startPaused(ctx, asn1.OptionValue{Opts: "application,tag:23", Value: req}, pause, encoded)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer op.finish()
+
+	p, err := op.receive(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var r extendedResponse
+	if err := p.decode("application,tag:24", &r); err != nil {
+		return nil, nil, err
+	}
+	respControls, err := decodeControls(p.Controls)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := r.Result.err(); err != nil {
+		return nil, respControls, err
+	}
+	return &ExtendedResponse{Name: string(r.Name), Value: r.Value}, respControls, nil
+}
+
+// The Who am I? extended operation, from RFC 4532.
+const whoAmIOID = "1.3.6.1.4.1.4203.1.11.3"
+
+// AuthzID is an authorization identity (RFC 4513 section 5.2.1.8).
+// The zero AuthzID is the anonymous identity.
+type AuthzID struct {
+	// DN is the identity in the "dn:" form.
+	DN string
+
+	// User is the identity in the "u:" form.
+	User string
+}
+
+// ParseAuthzID parses an authorization identity in the "dn:" or "u:"
+// form. The empty string is the anonymous identity.
+func ParseAuthzID(s string) (AuthzID, error) {
+	switch {
+	case s == "":
+		return AuthzID{}, nil
+	case strings.HasPrefix(s, "dn:"):
+		return AuthzID{DN: s[3:]}, nil
+	case strings.HasPrefix(s, "u:"):
+		return AuthzID{User: s[2:]}, nil
+	}
+	return AuthzID{}, LDAPError{"invalid authzId " + s}
+}
+
+func (id AuthzID) String() string {
+	switch {
+	case id.DN != "":
+		return "dn:" + id.DN
+	case id.User != "":
+		return "u:" + id.User
+	}
+	return ""
+}
+
+// Anonymous reports whether id is the anonymous identity.
+func (id AuthzID) Anonymous() bool {
+	return id.DN == "" && id.User == ""
+}
+
+// WhoAmI returns the authorization identity the server has associated
+// with the connection, for example after a SASL or proxied bind.
+func (l *conn) WhoAmI() (AuthzID, error) {
+	return l.WhoAmIContext(context.Background())
+}
+
+func (l *conn) WhoAmIContext(ctx context.Context) (AuthzID, error) {
+	resp, err := l.ExtendedContext(ctx, whoAmIOID, nil)
+	if err != nil {
+		return AuthzID{}, err
+	}
+	return ParseAuthzID(string(resp.Value))
+}
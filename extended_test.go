@@ -0,0 +1,80 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stesla/ldap/asn1"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestExtended(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, op := s.readRequest()
+		var req extendedRequest
+		if s.decodeRequest(op, "application,tag:23", &req) {
+			assert.Equal(t, "1.2.3.4", string(req.Name))
+			assert.Equal(t, "request", string(req.Value))
+		}
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:24", Value: extendedResponse{
+			Name:  []byte("1.2.3.5"),
+			Value: []byte("response"),
+		}})
+
+		id, op = s.readRequest()
+		var empty extendedRequest
+		if s.decodeRequest(op, "application,tag:23", &empty) {
+			assert.Nil(t, empty.Value)
+		}
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:24", Value: extendedResponse{
+			Result: ldapResult{ResultCode: ProtocolError},
+		}})
+	})
+	defer wait()
+
+	resp, err := conn.Extended("1.2.3.4", []byte("request"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, &ExtendedResponse{Name: "1.2.3.5", Value: []byte("response")}, resp)
+	}
+
+	_, err = conn.Extended("1.2.3.4", nil)
+	assert.True(t, errors.Is(err, ProtocolError), "unexpected error: %v", err)
+}
+
+func TestWhoAmI(t *testing.T) {
+	tests := []struct {
+		value    []byte
+		expected AuthzID
+		ok       bool
+	}{
+		{[]byte("dn:cn=alice,dc=example,dc=org"), AuthzID{DN: "cn=alice,dc=example,dc=org"}, true},
+		{[]byte("u:alice"), AuthzID{User: "alice"}, true},
+		{[]byte{}, AuthzID{}, true},
+		{nil, AuthzID{}, true},
+		{[]byte("alice"), AuthzID{}, false},
+	}
+	for _, test := range tests {
+		func() {
+			conn, wait := newTestConn(t, func(s *testServer) {
+				id, op := s.readRequest()
+				var req extendedRequest
+				if s.decodeRequest(op, "application,tag:23", &req) {
+					assert.Equal(t, "1.3.6.1.4.1.4203.1.11.3", string(req.Name))
+					assert.Nil(t, req.Value)
+				}
+				s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:24", Value: extendedResponse{
+					Value: test.value,
+				}})
+			})
+			defer wait()
+
+			authzID, err := conn.WhoAmI()
+			assert.Equal(t, test.ok, err == nil, "%q: %v", test.value, err)
+			assert.Equal(t, test.expected, authzID)
+			if test.ok {
+				assert.Equal(t, string(test.value), authzID.String())
+				assert.Equal(t, len(test.value) == 0, authzID.Anonymous())
+			}
+		}()
+	}
+}
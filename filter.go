@@ -1,77 +1,279 @@
 package ldap
 
 import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/stesla/ldap/asn1"
 )
 
-type Filter interface{}
+// Filter is a search filter (RFC 4511 section 4.5.1.7). Filters are
+// built with the functions in this file or parsed from strings with
+// ParseFilter. The zero Filter is the absolute true filter, "(&)".
+type Filter struct {
+	choice       filterChoice
+	filters      []Filter
+	attribute    string
+	value        string
+	substrings   []substring
+	rule         string
+	dnAttributes bool
+}
+
+type filterChoice int
+
+const (
+	filterAnd             filterChoice = 0
+	filterOr              filterChoice = 1
+	filterNot             filterChoice = 2
+	filterEqualityMatch   filterChoice = 3
+	filterSubstrings      filterChoice = 4
+	filterGreaterOrEqual  filterChoice = 5
+	filterLessOrEqual     filterChoice = 6
+	filterPresent         filterChoice = 7
+	filterApproxMatch     filterChoice = 8
+	filterExtensibleMatch filterChoice = 9
+)
 
 func And(filters ...Filter) Filter {
-	return asn1.OptionValue{Opts: "tag:0,set", Value: filters}
+	return Filter{choice: filterAnd, filters: filters}
 }
 
 func Or(filters ...Filter) Filter {
-	return asn1.OptionValue{Opts: "tag:1,set", Value: filters}
+	return Filter{choice: filterOr, filters: filters}
 }
 
 func Not(filter Filter) Filter {
-	return asn1.OptionValue{Opts: "tag:2", Value: filter}
+	return Filter{choice: filterNot, filters: []Filter{filter}}
 }
 
-type attributeValueAssertion struct {
-	Attribute, Value []byte
+func makeAssertion(choice filterChoice, attribute, value string) Filter {
+	return Filter{choice: choice, attribute: attribute, value: value}
 }
 
 func Equals(attribute, value string) Filter {
-	val := attributeValueAssertion{[]byte(attribute), []byte(value)}
-	return asn1.OptionValue{Opts: "tag:3", Value: val}
+	return makeAssertion(filterEqualityMatch, attribute, value)
 }
 
-type substring asn1.OptionValue
+func GreaterOrEqual(attribute, value string) Filter {
+	return makeAssertion(filterGreaterOrEqual, attribute, value)
+}
 
-type substringFilter struct {
-	Attribute  []byte
-	Substrings []asn1.OptionValue
+func LessOrEqual(attribute, value string) Filter {
+	return makeAssertion(filterLessOrEqual, attribute, value)
+}
+
+func ApproxMatch(attribute, value string) Filter {
+	return makeAssertion(filterApproxMatch, attribute, value)
 }
 
-func makeSubstring(tag, val string) substring {
-	return substring(asn1.OptionValue{Opts: "tag:" + tag, Value: []byte(val)})
+type substringKind int
+
+const (
+	substringInitial substringKind = 0
+	substringAny     substringKind = 1
+	substringFinal   substringKind = 2
+)
+
+type substring struct {
+	kind  substringKind
+	value string
 }
 
 func InitialSubstring(val string) substring {
-	return makeSubstring("0", val)
+	return substring{substringInitial, val}
 }
 
 func AnySubstring(val string) substring {
-	return makeSubstring("1", val)
+	return substring{substringAny, val}
 }
 
 func FinalSubstring(val string) substring {
-	return makeSubstring("2", val)
+	return substring{substringFinal, val}
 }
 
+// Substring returns a substrings filter. It needs at least one
+// substring, and none of them may be empty.
 func Substring(attribute string, substrings ...substring) Filter {
-	optionValues := make([]asn1.OptionValue, len(substrings))
-	for i, s := range substrings {
-		optionValues[i] = asn1.OptionValue(s)
-	}
-	val := substringFilter{[]byte(attribute), optionValues}
-	return asn1.OptionValue{Opts: "tag:4", Value: val}
+	return Filter{choice: filterSubstrings, attribute: attribute, substrings: substrings}
 }
 
 func Present(attribute string) Filter {
-	return asn1.OptionValue{Opts: "tag:7", Value: []byte(attribute)}
+	return Filter{choice: filterPresent, attribute: attribute}
+}
+
+// Matches returns an extensible match filter. Either rule or
+// attribute may be empty, but not both.
+//
+// A search with a filter that breaks these rules fails without being
+// sent, since the filter has no valid encoding or string form.
+func Matches(rule, attribute, value string) Filter {
+	return Filter{choice: filterExtensibleMatch, rule: rule, attribute: attribute, value: value}
+}
+
+// ExtensibleMatch describes an extensible match filter. Either
+// MatchingRule or Attribute may be empty, but not both. If
+// DNAttributes is set, the attributes of the entry's DN are matched
+// as well.
+type ExtensibleMatch struct {
+	MatchingRule string
+	Attribute    string
+	Value        string
+	DNAttributes bool
+}
+
+// Extensible returns the extensible match filter described by m.
+func Extensible(m ExtensibleMatch) Filter {
+	return extensibleMatch(m.MatchingRule, m.Attribute, m.Value, m.DNAttributes)
+}
+
+func extensibleMatch(rule, attribute, value string, dnAttributes bool) Filter {
+	f := Matches(rule, attribute, value)
+	f.dnAttributes = dnAttributes
+	return f
+}
+
+// String returns the RFC 4515 string representation of f.
+func (f Filter) String() string {
+	var b strings.Builder
+	f.writeTo(&b)
+	return b.String()
+}
+
+var filterTypes = map[filterChoice]string{
+	filterEqualityMatch:  "=",
+	filterGreaterOrEqual: ">=",
+	filterLessOrEqual:    "<=",
+	filterApproxMatch:    "~=",
+}
+
+func (f Filter) writeTo(b *strings.Builder) {
+	b.WriteByte('(')
+	switch f.choice {
+	case filterAnd, filterOr, filterNot:
+		b.WriteByte("&|!"[f.choice])
+		for _, ff := range f.filters {
+			ff.writeTo(b)
+		}
+	case filterEqualityMatch, filterGreaterOrEqual, filterLessOrEqual, filterApproxMatch:
+		b.WriteString(f.attribute)
+		b.WriteString(filterTypes[f.choice])
+		b.WriteString(escapeFilterValue(f.value))
+	case filterSubstrings:
+		b.WriteString(f.attribute)
+		b.WriteByte('=')
+		if len(f.substrings) == 0 || f.substrings[0].kind != substringInitial {
+			b.WriteByte('*')
+		}
+		for _, s := range f.substrings {
+			b.WriteString(escapeFilterValue(s.value))
+			if s.kind != substringFinal {
+				b.WriteByte('*')
+			}
+		}
+	case filterPresent:
+		b.WriteString(f.attribute)
+		b.WriteString("=*")
+	case filterExtensibleMatch:
+		b.WriteString(f.attribute)
+		if f.dnAttributes {
+			b.WriteString(":dn")
+		}
+		if f.rule != "" {
+			b.WriteByte(':')
+			b.WriteString(f.rule)
+		}
+		b.WriteString(":=")
+		b.WriteString(escapeFilterValue(f.value))
+	}
+	b.WriteByte(')')
+}
+
+// escapeFilterValue escapes the characters that may not appear in an
+// assertion value (RFC 4515 section 3). If s is not valid UTF-8, all
+// non-ASCII bytes are escaped as well.
+func escapeFilterValue(s string) string {
+	escapeHigh := !utf8.ValidString(s)
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == 0 || c == '(' || c == ')' || c == '*' || c == '\\' || (escapeHigh && c >= 0x80) {
+			b.WriteByte('\\')
+			b.WriteByte("0123456789abcdef"[c>>4])
+			b.WriteByte("0123456789abcdef"[c&0xf])
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+type attributeValueAssertion struct {
+	Attribute, Value []byte
+}
+
+type substringFilter struct {
+	Attribute  []byte
+	Substrings []asn1.OptionValue
 }
 
 type matchingRuleAssertion struct {
 	MatchingRule []byte `asn1:"tag:1,optional"`
 	Type         []byte `asn1:"tag:2,optional"`
 	MatchValue   []byte `asn1:"tag:3"`
-	DnAttributes bool   `asn1:"tag:4"`
+	DnAttributes bool   `asn1:"tag:4,optional"`
 }
 
-func Matches(rule, attribute, value string) Filter {
-	val := matchingRuleAssertion{
-		[]byte(rule), []byte(attribute), []byte(value), false}
-	return asn1.OptionValue{Opts: "tag:9", Value: val}
+// encode returns f in a form that can be encoded by the asn1 package,
+// or an error if f was built in a way that cannot be sent.
+func (f Filter) encode() (asn1.OptionValue, error) {
+	opts := "tag:" + strconv.Itoa(int(f.choice))
+	switch f.choice {
+	case filterAnd, filterOr:
+		filters := make([]asn1.OptionValue, len(f.filters))
+		for i, ff := range f.filters {
+			var err error
+			if filters[i], err = ff.encode(); err != nil {
+				return asn1.OptionValue{}, err
+			}
+		}
+		return asn1.OptionValue{Opts: opts + ",set", Value: filters}, nil
+	case filterNot:
+		// A CHOICE cannot be implicitly tagged, so the filter
+		// is wrapped to give it an explicit tag.
+		inner, err := f.filters[0].encode()
+		if err != nil {
+			return asn1.OptionValue{}, err
+		}
+		return asn1.OptionValue{Opts: opts, Value: []asn1.OptionValue{inner}}, nil
+	case filterSubstrings:
+		if len(f.substrings) == 0 {
+			return asn1.OptionValue{}, LDAPError{"substrings filter for " + f.attribute + " has no substrings"}
+		}
+		substrings := make([]asn1.OptionValue, len(f.substrings))
+		for i, s := range f.substrings {
+			if s.value == "" {
+				return asn1.OptionValue{}, LDAPError{"substrings filter for " + f.attribute + " has an empty substring"}
+			}
+			substrings[i] = asn1.OptionValue{Opts: "tag:" + strconv.Itoa(int(s.kind)), Value: []byte(s.value)}
+		}
+		return asn1.OptionValue{Opts: opts, Value: substringFilter{[]byte(f.attribute), substrings}}, nil
+	case filterPresent:
+		return asn1.OptionValue{Opts: opts, Value: []byte(f.attribute)}, nil
+	case filterExtensibleMatch:
+		if f.rule == "" && f.attribute == "" {
+			return asn1.OptionValue{}, LDAPError{"extensible match filter requires an attribute or a matching rule"}
+		}
+		val := matchingRuleAssertion{MatchValue: []byte(f.value), DnAttributes: f.dnAttributes}
+		if f.rule != "" {
+			val.MatchingRule = []byte(f.rule)
+		}
+		if f.attribute != "" {
+			val.Type = []byte(f.attribute)
+		}
+		return asn1.OptionValue{Opts: opts, Value: val}, nil
+	}
+	val := attributeValueAssertion{[]byte(f.attribute), []byte(f.value)}
+	return asn1.OptionValue{Opts: opts, Value: val}, nil
 }
@@ -0,0 +1,97 @@
+package ldap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stesla/ldap/asn1"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestEncodeFilter(t *testing.T) {
+	var tests = []struct {
+		in  Filter
+		out []byte
+	}{
+		{Equals("cn", "x"), []byte{0xa3, 0x07, 0x04, 0x02, 'c', 'n', 0x04, 0x01, 'x'}},
+		{Not(Equals("cn", "x")), []byte{0xa2, 0x09, 0xa3, 0x07, 0x04, 0x02, 'c', 'n', 0x04, 0x01, 'x'}},
+		{Present("cn"), []byte{0x87, 0x02, 'c', 'n'}},
+		{And(), []byte{0xa0, 0x00}},
+		{Or(Present("cn"), Present("sn")), []byte{0xa1, 0x08, 0x87, 0x02, 'c', 'n', 0x87, 0x02, 's', 'n'}},
+		{Substring("cn", InitialSubstring("a"), FinalSubstring("z")), []byte{
+			0xa4, 0x0c, 0x04, 0x02, 'c', 'n', 0x30, 0x06, 0x80, 0x01, 'a', 0x82, 0x01, 'z'}},
+		{Extensible(ExtensibleMatch{Attribute: "cn", Value: "x", DNAttributes: true}), []byte{
+			0xa9, 0x0a, 0x82, 0x02, 'c', 'n', 0x83, 0x01, 'x', 0x84, 0x01, 0xff}},
+		{Matches("2.5.13.5", "", "x"), []byte{
+			0xa9, 0x0d, 0x81, 0x08, '2', '.', '5', '.', '1', '3', '.', '5', 0x83, 0x01, 'x'}},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		enc := asn1.NewEncoder(&buf)
+		enc.Implicit = true
+		encoded, err := test.in.encode()
+		assert.NoError(t, err, test.in.String())
+		if assert.NoError(t, enc.Encode(encoded), test.in.String()) {
+			assert.Equal(t, test.out, buf.Bytes(), test.in.String())
+		}
+	}
+}
+
+func TestFilterString(t *testing.T) {
+	var tests = []struct {
+		in  Filter
+		out string
+	}{
+		{Filter{}, "(&)"},
+		{Or(), "(|)"},
+		{Equals("cn", "Alice Lastname"), "(cn=Alice Lastname)"},
+		{Equals("cn", "*()\\\x00"), `(cn=\2a\28\29\5c\00)`},
+		{Equals("sn", "Lučić"), "(sn=Lučić)"},
+		{Equals("sn", "\xc4"), `(sn=\c4)`},
+		{Present("objectClass"), "(objectClass=*)"},
+		{GreaterOrEqual("uidNumber", "1000"), "(uidNumber>=1000)"},
+		{LessOrEqual("uidNumber", "1999"), "(uidNumber<=1999)"},
+		{ApproxMatch("sn", "Lastnam"), "(sn~=Lastnam)"},
+		{Substring("uid", InitialSubstring("al")), "(uid=al*)"},
+		{Substring("uid", FinalSubstring("ce")), "(uid=*ce)"},
+		{Substring("uid", AnySubstring("l"), AnySubstring("c")), "(uid=*l*c*)"},
+		{Substring("cn", InitialSubstring("A*"), AnySubstring("("), FinalSubstring(")")), `(cn=A\2a*\28*\29)`},
+		{Matches("caseExactMatch", "cn", "Alice"), "(cn:caseExactMatch:=Alice)"},
+		{Extensible(ExtensibleMatch{MatchingRule: "2.4.6.8.10", Value: "Dino", DNAttributes: true}), "(:dn:2.4.6.8.10:=Dino)"},
+		{Extensible(ExtensibleMatch{Attribute: "ou", Value: "users", DNAttributes: true}), "(ou:dn:=users)"},
+		{Not(Equals("uid", "alice")), "(!(uid=alice))"},
+		{And(Equals("objectClass", "posixAccount"), Or(Equals("uid", "alice"), Equals("uid", "bob"))),
+			"(&(objectClass=posixAccount)(|(uid=alice)(uid=bob)))"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.out, test.in.String())
+
+		f, err := ParseFilter(test.out)
+		if assert.NoError(t, err, test.out) {
+			assert.Equal(t, test.in, f, test.out)
+		}
+	}
+
+	// These have no string form that parses back to the same filter,
+	// so they cannot be sent.
+	for _, f := range []Filter{
+		Substring("cn"),
+		Substring("cn", AnySubstring("")),
+		Substring("cn", InitialSubstring(""), FinalSubstring("z")),
+		Matches("", "", "x"),
+		Not(And(Present("cn"), Substring("cn"))),
+	} {
+		_, err := f.encode()
+		assert.Error(t, err, f.String())
+	}
+}
+
+func TestSearchInvalidFilter(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {})
+	defer wait()
+
+	_, err := conn.Search(SearchRequest{BaseObject: []byte("dc=example,dc=org"), Filter: Matches("", "", "x")})
+	assert.Equal(t, LDAPError{"extensible match filter requires an attribute or a matching rule"}, err)
+}
@@ -1,9 +1,9 @@
 module github.com/stesla/ldap
 
-go 1.7
+go 1.17
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/stretchr/testify.v1 v1.2.2 // indirect
+	gopkg.in/stretchr/testify.v1 v1.2.2
 )
@@ -1,7 +1,7 @@
 package ldap
 
 import (
-	"bytes"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"github.com/stesla/ldap/asn1"
@@ -10,31 +10,97 @@ import (
 	"sync"
 )
 
+// Conn is a connection to an LDAP server. Operations may be issued
+// concurrently from multiple goroutines, with the exception of
+// StartTLS.
+//
+// Each operation has a variant that takes a context. If the context
+// is done before the operation completes, the operation returns the
+// context's error and the request is abandoned, leaving the
+// connection usable for other operations.
 type Conn interface {
 	net.Conn
 	Bind(user, password string) error
+	BindContext(ctx context.Context, user, password string) error
+	BindWithControls(ctx context.Context, user, password string, controls []Control) ([]Control, error)
+	AnonymousBind() error
+	AnonymousBindContext(ctx context.Context) error
+	UnauthenticatedBind(user string) error
+	UnauthenticatedBindContext(ctx context.Context, user string) error
+	SASLBind(mechanism SASLMechanism) error
+	SASLBindContext(ctx context.Context, mechanism SASLMechanism) error
+	SASLBindWithControls(ctx context.Context, mechanism SASLMechanism, controls []Control) ([]Control, error)
 	Unbind() error
 	Search(req SearchRequest) ([]SearchResult, error)
+	SearchContext(ctx context.Context, req SearchRequest) ([]SearchResult, error)
+	SearchStream(ctx context.Context, req SearchRequest) (*SearchStream, error)
+	PersistentSearch(ctx context.Context, req SearchRequest, changeTypes ChangeType, changesOnly bool) (*SearchStream, error)
 	StartTLS(config *tls.Config) error
+	StartTLSContext(ctx context.Context, config *tls.Config) error
+	Add(dn string, attrs map[string][]string) error
+	AddContext(ctx context.Context, dn string, attrs map[string][]string) error
+	AddWithControls(ctx context.Context, dn string, attrs map[string][]string, controls []Control) ([]Control, error)
+	Modify(dn string, changes []Change) error
+	ModifyContext(ctx context.Context, dn string, changes []Change) error
+	ModifyWithControls(ctx context.Context, dn string, changes []Change, controls []Control) ([]Control, error)
+	Delete(dn string) error
+	DeleteContext(ctx context.Context, dn string) error
+	DeleteWithControls(ctx context.Context, dn string, controls []Control) ([]Control, error)
+	ModifyDN(dn, newRDN string, deleteOldRDN bool, newSuperior string) error
+	ModifyDNContext(ctx context.Context, dn, newRDN string, deleteOldRDN bool, newSuperior string) error
+	ModifyDNWithControls(ctx context.Context, dn, newRDN string, deleteOldRDN bool, newSuperior string, controls []Control) ([]Control, error)
+	Compare(dn, attribute, value string) (bool, error)
+	CompareContext(ctx context.Context, dn, attribute, value string) (bool, error)
+	CompareWithControls(ctx context.Context, dn, attribute, value string, controls []Control) (bool, []Control, error)
+	SearchPaged(req SearchRequest, pageSize int) ([]SearchResult, error)
+	SearchPagedContext(ctx context.Context, req SearchRequest, pageSize int) ([]SearchResult, error)
+	SearchPagedFunc(ctx context.Context, req SearchRequest, pageSize int, fn func([]SearchResult) error) error
+	SearchSorted(req SearchRequest, keys ...SortKey) ([]SearchResult, error)
+	SearchSortedContext(ctx context.Context, req SearchRequest, keys ...SortKey) ([]SearchResult, error)
+	SearchVLV(req SearchRequest, keys []SortKey, vlv VLVControl) ([]SearchResult, VLVResultControl, error)
+	SearchVLVContext(ctx context.Context, req SearchRequest, keys []SortKey, vlv VLVControl) ([]SearchResult, VLVResultControl, error)
+	ChaseReferrals(dial ReferralDialer, maxHops int)
+	Extended(oid string, value []byte) (*ExtendedResponse, error)
+	ExtendedContext(ctx context.Context, oid string, value []byte) (*ExtendedResponse, error)
+	ExtendedWithControls(ctx context.Context, oid string, value []byte, controls []Control) (*ExtendedResponse, []Control, error)
+	WhoAmI() (AuthzID, error)
+	WhoAmIContext(ctx context.Context) (AuthzID, error)
+	PasswordModify(userDN, oldPassword, newPassword string) (string, error)
+	PasswordModifyContext(ctx context.Context, userDN, oldPassword, newPassword string) (string, error)
 }
 
 func RoundRobin(addr string, dialer func(string) (Conn, error)) (Conn, error) {
+	return RoundRobinContext(context.Background(), addr,
+		func(_ context.Context, addr string) (Conn, error) {
+			return dialer(addr)
+		})
+}
+
+func RoundRobinContext(ctx context.Context, addr string, dialer func(context.Context, string) (Conn, error)) (Conn, error) {
 	parts := strings.Split(addr, ":")
-	hosts, err := net.LookupHost(parts[0])
+	hosts, err := net.DefaultResolver.LookupHost(ctx, parts[0])
 	if err != nil {
 		return nil, fmt.Errorf("LookupHost: %v", err)
 	}
 	for _, host := range hosts {
-		conn, err := dialer(fmt.Sprintf("%s:%s", host, parts[1]))
+		conn, err := dialer(ctx, fmt.Sprintf("%s:%s", host, parts[1]))
 		if err == nil {
 			return conn, nil
 		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 	}
 	return nil, fmt.Errorf("could not connect to an ldap server")
 }
 
 func Dial(addr string) (Conn, error) {
-	tcp, err := net.Dial("tcp", addr)
+	return DialContext(context.Background(), addr)
+}
+
+func DialContext(ctx context.Context, addr string) (Conn, error) {
+	var d net.Dialer
+	tcp, err := d.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return nil, err
 	}
@@ -42,7 +108,12 @@ func Dial(addr string) (Conn, error) {
 }
 
 func DialSSL(addr string, tlsConfig *tls.Config) (Conn, error) {
-	tcp, err := tls.Dial("tcp", addr, tlsConfig)
+	return DialSSLContext(context.Background(), addr, tlsConfig)
+}
+
+func DialSSLContext(ctx context.Context, addr string, tlsConfig *tls.Config) (Conn, error) {
+	d := tls.Dialer{Config: tlsConfig}
+	tcp, err := d.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return nil, err
 	}
@@ -50,51 +121,106 @@ func DialSSL(addr string, tlsConfig *tls.Config) (Conn, error) {
 }
 
 func DialTLS(addr string, tlsConfig *tls.Config) (Conn, error) {
-	tcp, err := Dial(addr)
+	return DialTLSContext(context.Background(), addr, tlsConfig)
+}
+
+func DialTLSContext(ctx context.Context, addr string, tlsConfig *tls.Config) (Conn, error) {
+	var d net.Dialer
+	tcp, err := d.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return nil, err
 	}
 	conn := newConn(tcp)
 
-	err = conn.StartTLS(tlsConfig)
+	err = conn.StartTLSContext(ctx, tlsConfig)
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 
 	return conn, nil
 }
 
-type conn struct {
-	net.Conn
-	id sequence
-}
-
-func newConn(tcp net.Conn) *conn {
-	return &conn{
-		Conn: tcp,
-	}
-}
-
 type ldapMessage struct {
 	MessageId  int
 	ProtocolOp interface{}
-	Controls   []interface{} `asn1:"tag:0,optional"`
+	Controls   []control `asn1:"tag:0,optional"`
 }
 
-type ldapResultCode int16
+type control struct {
+	Type        []byte
+	Criticality bool   `asn1:"optional"`
+	Value       []byte `asn1:"optional"`
+}
 
-const (
-	Success                     ldapResultCode = 0
-	InappropriateAuthentication ldapResultCode = 48
-	InvalidCredentials          ldapResultCode = 49
-	InsufficientAccessRights    ldapResultCode = 59
-)
+// findControl returns the control of type oid from controls.
+func findControl(controls []control, oid string) (control, bool) {
+	for _, c := range controls {
+		if string(c.Type) == oid {
+			return c, true
+		}
+	}
+	return control{}, false
+}
 
 type ldapResult struct {
-	ResultCode ldapResultCode
+	ResultCode ResultCode `asn1:"enum"`
 	MatchedDN  []byte
 	Message    []byte
-	Referral   []interface{} `asn1:"tag:3,optional"`
+	Referral   [][]byte `asn1:"tag:3,optional"`
+}
+
+// err returns nil if r is successful and a *ResultError otherwise.
+func (r *ldapResult) err() error {
+	if r.ResultCode == Success {
+		return nil
+	}
+	return r.resultError()
+}
+
+func (r *ldapResult) resultError() *ResultError {
+	return &ResultError{r.result()}
+}
+
+func (r *ldapResult) result() Result {
+	result := Result{
+		ResultCode: r.ResultCode,
+		MatchedDN:  string(r.MatchedDN),
+		Message:    string(r.Message),
+	}
+	for _, url := range r.Referral {
+		result.Referral = append(result.Referral, string(url))
+	}
+	return result
+}
+
+// roundTrip sends a single request with controls and decodes the
+// single response into resp. It returns the controls from the
+// response.
+func (l *conn) roundTrip(ctx context.Context, req, resp asn1.OptionValue, controls []Control) ([]Control, error) {
+	encoded, err := encodeControls(controls)
+	if err != nil {
+		return nil, err
+	}
+	op, err := l.start(ctx, req, encoded...)
+	if err != nil {
+		return nil, err
+	}
+	defer op.finish()
+
+	p, err := op.receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.decode(resp.Opts, resp.Value); err != nil {
+		return nil, err
+	}
+	return decodeControls(p.Controls)
+}
+
+type attribute struct {
+	Type   []byte
+	Values [][]byte `asn1:"set"`
 }
 
 type bindRequest struct {
@@ -103,39 +229,95 @@ type bindRequest struct {
 	Auth    interface{}
 }
 
-func (l *conn) Bind(user, password string) (err error) {
-	msg := ldapMessage{
-		MessageId: l.id.Next(),
-		ProtocolOp: asn1.OptionValue{
-			Opts: "application,tag:0", Value: bindRequest{
-				Version: 3,
-				Name:    []byte(user),
-				// TODO: Support SASL
-				Auth: simpleAuth(password),
-			},
-		},
-	}
+type bindResponse struct {
+	Result          ldapResult `asn1:"components"`
+	ServerSaslCreds []byte     `asn1:"tag:7,optional"`
+}
 
-	enc := asn1.NewEncoder(l)
-	enc.Implicit = true
-	if err = enc.Encode(msg); err != nil {
-		return fmt.Errorf("Encode: %v", err)
+// bind sends a single bind request and returns the response and its
+// controls.
+func (l *conn) bind(ctx context.Context, name string, auth interface{}, controls []Control) (*bindResponse, []Control, error) {
+	req := bindRequest{
+		Version: 3,
+		Name:    []byte(name),
+		Auth:    auth,
 	}
 
-	var result ldapResult
-	msg = ldapMessage{
-		ProtocolOp: asn1.OptionValue{Opts: "application,tag:1", Value: &result},
+	var resp bindResponse
+	respControls, err := l.roundTrip(ctx,
+		asn1.OptionValue{Opts: "application,tag:0", Value: req},
+		asn1.OptionValue{Opts: "application,tag:1", Value: &resp}, controls)
+	if err != nil {
+		return nil, nil, err
 	}
-	dec := asn1.NewDecoder(l)
-	dec.Implicit = true
-	if err = dec.Decode(&msg); err != nil {
-		return fmt.Errorf("Decode: %v", err)
+	return &resp, respControls, nil
+}
+
+// ErrEmptyPassword is returned by Bind when it is given a DN with an
+// empty password. Many servers treat that as an unauthenticated bind
+// (RFC 4513 section 5.1.2) and report success without checking any
+// credentials, so it is refused unless requested explicitly with
+// UnauthenticatedBind.
+var ErrEmptyPassword = LDAPError{"empty password for simple bind"}
+
+// Bind authenticates user with password using a simple bind. If user
+// and password are both empty, it is an anonymous bind. If only the
+// password is empty, Bind returns ErrEmptyPassword.
+func (l *conn) Bind(user, password string) error {
+	return l.BindContext(context.Background(), user, password)
+}
+
+// BindContext is like Bind. Bind requests cannot be abandoned, so if
+// ctx is done first, the outcome of the bind is unknown.
+func (l *conn) BindContext(ctx context.Context, user, password string) error {
+	_, err := l.BindWithControls(ctx, user, password, nil)
+	return err
+}
+
+// BindWithControls is like BindContext, but sends controls with the
+// request and returns the controls from the response, even if the
+// bind fails.
+func (l *conn) BindWithControls(ctx context.Context, user, password string, controls []Control) ([]Control, error) {
+	if user != "" && password == "" {
+		return nil, ErrEmptyPassword
 	}
+	return l.simpleBind(ctx, user, password, controls)
+}
+
+// AnonymousBind performs an anonymous simple bind, with no name and no
+// password, returning the connection to the anonymous state.
+func (l *conn) AnonymousBind() error {
+	return l.AnonymousBindContext(context.Background())
+}
+
+// AnonymousBindContext is like AnonymousBind. See BindContext for how
+// ctx is handled.
+func (l *conn) AnonymousBindContext(ctx context.Context) error {
+	_, err := l.simpleBind(ctx, "", "", nil)
+	return err
+}
 
-	if result.ResultCode != Success {
-		return fmt.Errorf("ldap.Bind unsuccessful: resultCode = %v", result.ResultCode)
+// UnauthenticatedBind performs an unauthenticated simple bind, with
+// the name user and no password (RFC 4513 section 5.1.2). This does
+// not prove the client's identity, and servers are expected to treat
+// the connection as anonymous, for example for logging or tracing.
+func (l *conn) UnauthenticatedBind(user string) error {
+	return l.UnauthenticatedBindContext(context.Background(), user)
+}
+
+// UnauthenticatedBindContext is like UnauthenticatedBind. See
+// BindContext for how ctx is handled.
+func (l *conn) UnauthenticatedBindContext(ctx context.Context, user string) error {
+	_, err := l.simpleBind(ctx, user, "", nil)
+	return err
+}
+
+func (l *conn) simpleBind(ctx context.Context, user, password string, controls []Control) ([]Control, error) {
+	resp, respControls, err := l.bind(ctx, user, simpleAuth(password), controls)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return respControls, resp.Result.err()
 }
 
 func simpleAuth(password string) interface{} {
@@ -145,22 +327,10 @@ func simpleAuth(password string) interface{} {
 func (l *conn) Unbind() error {
 	defer l.Close()
 
-	msg := ldapMessage{
-		MessageId: l.id.Next(),
-		ProtocolOp: asn1.OptionValue{Opts: "application,tag:2", Value: asn1.RawValue{
-			Class: asn1.ClassUniversal,
-			Tag:   asn1.TagNull,
-		},
-		},
-	}
-
-	enc := asn1.NewEncoder(l)
-	enc.Implicit = true
-	if err := enc.Encode(msg); err != nil {
-		return fmt.Errorf("Encode: %v", err)
-	}
-
-	return nil
+	return l.send(context.Background(), l.id.Next(), asn1.OptionValue{Opts: "application,tag:2", Value: asn1.RawValue{
+		Class: asn1.ClassUniversal,
+		Tag:   asn1.TagNull,
+	}})
 }
 
 type sequence struct {
@@ -168,25 +338,59 @@ type sequence struct {
 	l    sync.Mutex
 }
 
+// Next returns the next message id. Message id zero is reserved for
+// unsolicited notifications, so the first id is one.
 func (gen *sequence) Next() (id int) {
 	gen.l.Lock()
 	defer gen.l.Unlock()
-	id = gen.next
 	gen.next++
+	id = gen.next
 	return
 }
 
 type SearchRequest struct {
+	BaseObject []byte
+	Scope      SearchScope
+	Deref      DerefAliases
+	SizeLimit  int
+	TimeLimit  int
+	TypesOnly  bool
+	Filter     Filter
+	Attributes [][]byte
+
+	// Controls are sent with the search. They are not sent to
+	// other servers when following referrals.
+	Controls []Control
+}
+
+type searchRequest struct {
 	BaseObject []byte
 	Scope      SearchScope  `asn1:"enum"`
 	Deref      DerefAliases `asn1:"enum"`
 	SizeLimit  int
 	TimeLimit  int
 	TypesOnly  bool
-	Filter
+	Filter     asn1.OptionValue
 	Attributes [][]byte
 }
 
+func (req SearchRequest) encode() (searchRequest, error) {
+	filter, err := req.Filter.encode()
+	if err != nil {
+		return searchRequest{}, err
+	}
+	return searchRequest{
+		BaseObject: req.BaseObject,
+		Scope:      req.Scope,
+		Deref:      req.Deref,
+		SizeLimit:  req.SizeLimit,
+		TimeLimit:  req.TimeLimit,
+		TypesOnly:  req.TypesOnly,
+		Filter:     filter,
+		Attributes: req.Attributes,
+	}, nil
+}
+
 type SearchScope int
 
 const (
@@ -207,70 +411,36 @@ const (
 type SearchResult struct {
 	DN         string
 	Attributes map[string][]string
+
+	// References holds the URLs of a continuation reference
+	// returned by a search that is not chasing referrals. A
+	// SearchResult with References has no DN or Attributes.
+	References []string
 }
 
 func (l *conn) Search(req SearchRequest) ([]SearchResult, error) {
-	msg := ldapMessage{
-		MessageId:  l.id.Next(),
-		ProtocolOp: asn1.OptionValue{Opts: "application,tag:3", Value: req},
-	}
-
-	enc := asn1.NewEncoder(l)
-	enc.Implicit = true
-	if err := enc.Encode(msg); err != nil {
-		return nil, fmt.Errorf("Encode: %v", err)
-	}
-
-	dec := asn1.NewDecoder(l)
-	dec.Implicit = true
+	return l.SearchContext(context.Background(), req)
+}
 
-	results := []SearchResult{}
+func (l *conn) SearchContext(ctx context.Context, req SearchRequest) ([]SearchResult, error) {
+	results, _, err := l.search(ctx, req, nil)
+	return results, err
+}
 
-loop:
-	for {
-		var raw asn1.RawValue
-		resp := ldapMessage{ProtocolOp: &raw}
-		if err := dec.Decode(&resp); err != nil {
-			return nil, fmt.Errorf("Decode Envelope: %v", err)
-		}
-		rdec := asn1.NewDecoder(bytes.NewBuffer(raw.RawBytes))
-		rdec.Implicit = true
-		switch raw.Tag {
-		case 4:
-			var r struct {
-				Name       []byte
-				Attributes []struct {
-					Type   []byte
-					Values [][]byte `asn1:"set"`
-				}
-			}
-			if err := rdec.Decode(asn1.OptionValue{Opts: "application,tag:4", Value: &r}); err != nil {
-				return nil, fmt.Errorf("Decode SearchResult: %v", err)
-			}
-			result := SearchResult{string(r.Name), make(map[string][]string)}
-			for _, a := range r.Attributes {
-				vals := []string{}
-				for _, v := range a.Values {
-					vals = append(vals, string(v))
-				}
-				result.Attributes[string(a.Type)] = vals
-			}
-			results = append(results, result)
-		case 5: // SearchResultDone
-			var r ldapResult
-			if err := rdec.Decode(asn1.OptionValue{Opts: "application,tag:5", Value: &r}); err != nil {
-				return nil, fmt.Errorf("Decode SearchResultDone: %v", err)
-			}
-			if r.ResultCode != Success {
-				return nil, fmt.Errorf("ResultCode = %d", r.ResultCode)
-			}
-			break loop
-		case 19: // SearchResultReference
-			// TODO
-		}
+// search performs a search with the given request controls in
+// addition to req.Controls. It returns the entries and the controls
+// from the SearchResultDone, which are returned even if the search
+// fails.
+func (l *conn) search(ctx context.Context, req SearchRequest, controls []control) ([]SearchResult, []control, error) {
+	s, err := l.searchStream(ctx, req, controls)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return results, nil
+	results, err := collectSearch(ctx, l.referralChaser(), req, s)
+	if err != nil {
+		return nil, s.controls, err
+	}
+	return results, s.controls, nil
 }
 
 type extendedRequest struct {
@@ -284,31 +454,30 @@ type extendedResponse struct {
 	Value  []byte     `asn1:"tag:11,optional"`
 }
 
-func (l *conn) StartTLS(config *tls.Config) error {
-	msg := ldapMessage{
-		MessageId:  l.id.Next(),
-		ProtocolOp: asn1.OptionValue{Opts: "application,tag:23", Value: extendedRequest{Name: []byte("1.3.6.1.4.1.1466.20037")}},
-	}
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
 
-	enc := asn1.NewEncoder(l)
-	enc.Implicit = true
-	if err := enc.Encode(msg); err != nil {
-		return fmt.Errorf("Encode: %v", err)
-	}
-
-	var r extendedResponse
-	resp := ldapMessage{ProtocolOp: asn1.OptionValue{Opts: "application,tag:24", Value: &r}}
+// StartTLS upgrades the connection to TLS. It must not be called
+// while other operations are outstanding on the connection.
+func (l *conn) StartTLS(config *tls.Config) error {
+	return l.StartTLSContext(context.Background(), config)
+}
 
-	dec := asn1.NewDecoder(l)
-	dec.Implicit = true
-	if err := dec.Decode(&resp); err != nil {
-		return fmt.Errorf("Decode: %v", err)
-	}
+// StartTLSContext is like StartTLS. A StartTLS request cannot be
+// abandoned, so if ctx is done first, the connection is closed.
+func (l *conn) StartTLSContext(ctx context.Context, config *tls.Config) error {
+	pause := make(chan struct{})
+	defer close(pause)
 
-	if r.Result.ResultCode != Success {
-		return fmt.Errorf("ResultCode = %d", r.Result.ResultCode)
+	if _, _, err := l.extended(ctx, startTLSOID, nil, pause, nil); err != nil {
+		if ctx.Err() != nil {
+			l.Close()
+		}
+		return err
 	}
 
-	l.Conn = tls.Client(l.Conn, config)
-	return nil
+	// The reader is paused until we return, so it is safe to
+	// replace the connection out from under it.
+	tlsConn := tls.Client(l.Conn, config)
+	l.Conn = tlsConn
+	return tlsConn.HandshakeContext(ctx)
 }
@@ -0,0 +1,75 @@
+package ldap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stesla/ldap/asn1"
+)
+
+type ModifyOperation int
+
+const (
+	AddValues     ModifyOperation = 0
+	DeleteValues  ModifyOperation = 1
+	ReplaceValues ModifyOperation = 2
+	// IncrementValue is the increment operation from RFC 4525. It
+	// requires exactly one value, the amount to add.
+	IncrementValue ModifyOperation = 3
+)
+
+// Change is a single modification to an attribute of an entry. For
+// DeleteValues, an empty Values deletes the attribute entirely; for
+// ReplaceValues, it removes all of the attribute's values.
+type Change struct {
+	Operation ModifyOperation
+	Attribute string
+	Values    []string
+}
+
+type change struct {
+	Operation    ModifyOperation `asn1:"enum"`
+	Modification attribute
+}
+
+type modifyRequest struct {
+	Object  []byte
+	Changes []change
+}
+
+func (l *conn) Modify(dn string, changes []Change) error {
+	return l.ModifyContext(context.Background(), dn, changes)
+}
+
+func (l *conn) ModifyContext(ctx context.Context, dn string, changes []Change) error {
+	_, err := l.ModifyWithControls(ctx, dn, changes, nil)
+	return err
+}
+
+// ModifyWithControls is like ModifyContext, but sends controls with
+// the request and returns the controls from the response, even if the
+// modify fails.
+func (l *conn) ModifyWithControls(ctx context.Context, dn string, changes []Change, controls []Control) ([]Control, error) {
+	req := modifyRequest{Object: []byte(dn), Changes: make([]change, len(changes))}
+	for i, c := range changes {
+		if c.Operation == IncrementValue && len(c.Values) != 1 {
+			return nil, fmt.Errorf("ldap.Modify: increment of %s requires exactly one value", c.Attribute)
+		}
+		req.Changes[i] = change{
+			Operation:    c.Operation,
+			Modification: attribute{Type: []byte(c.Attribute), Values: makeValues(c.Values)},
+		}
+	}
+
+	var result ldapResult
+	respControls, err := l.roundTrip(ctx,
+		asn1.OptionValue{Opts: "application,tag:6", Value: req},
+		asn1.OptionValue{Opts: "application,tag:7", Value: &result}, controls)
+	if err != nil {
+		return nil, err
+	}
+
+	return respControls, l.chase(ctx, result.err(), dn, func(ctx context.Context, c Conn, dn string) error {
+		return c.ModifyContext(ctx, dn, changes)
+	})
+}
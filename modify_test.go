@@ -0,0 +1,45 @@
+package ldap
+
+import (
+	"testing"
+
+	"github.com/stesla/ldap/asn1"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestModify(t *testing.T) {
+	dn := "cn=Alice Lastname,ou=users,dc=example,dc=org"
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, op := s.readRequest()
+		var req modifyRequest
+		if s.decodeRequest(op, "application,tag:6", &req) {
+			assert.Equal(t, dn, string(req.Object))
+			assert.Equal(t, []change{
+				{ReplaceValues, attribute{[]byte("loginShell"), [][]byte{[]byte("/bin/zsh")}}},
+				{AddValues, attribute{[]byte("description"), [][]byte{[]byte("admin")}}},
+				{DeleteValues, attribute{[]byte("telephoneNumber"), [][]byte{}}},
+				{IncrementValue, attribute{[]byte("uidNumber"), [][]byte{[]byte("1")}}},
+			}, req.Changes)
+		}
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:7", Value: ldapResult{}})
+	})
+	defer wait()
+
+	err := conn.Modify(dn, []Change{
+		{ReplaceValues, "loginShell", []string{"/bin/zsh"}},
+		{AddValues, "description", []string{"admin"}},
+		{DeleteValues, "telephoneNumber", nil},
+		{IncrementValue, "uidNumber", []string{"1"}},
+	})
+	assert.NoError(t, err)
+}
+
+func TestModifyIncrementRequiresOneValue(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {})
+	defer wait()
+
+	err := conn.Modify("cn=Alice Lastname,ou=users,dc=example,dc=org", []Change{
+		{IncrementValue, "uidNumber", []string{"1", "2"}},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,102 @@
+package ldap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/stesla/ldap/asn1"
+)
+
+// The Simple Paged Results control, from RFC 2696.
+const pagedResultsOID = "1.2.840.113556.1.4.319"
+
+type pagedResultsValue struct {
+	Size   int
+	Cookie []byte
+}
+
+func pagedResultsControl(size int, cookie []byte) (control, error) {
+	var buf bytes.Buffer
+	enc := asn1.NewEncoder(&buf)
+	if err := enc.Encode(pagedResultsValue{Size: size, Cookie: cookie}); err != nil {
+		return control{}, fmt.Errorf("Encode: %v", err)
+	}
+	return control{Type: []byte(pagedResultsOID), Value: buf.Bytes()}, nil
+}
+
+// pagedResultsCookie returns the cookie from the paged results
+// control in controls. An empty cookie means there are no more pages.
+func pagedResultsCookie(controls []control) ([]byte, error) {
+	c, ok := findControl(controls, pagedResultsOID)
+	if !ok {
+		// The server does not support paging, so it has
+		// returned everything it is going to.
+		return nil, nil
+	}
+	var v pagedResultsValue
+	dec := asn1.NewDecoder(bytes.NewBuffer(c.Value))
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("Decode paged results control: %v", err)
+	}
+	return v.Cookie, nil
+}
+
+// SearchPaged performs req using the Simple Paged Results control,
+// requesting pageSize entries at a time, and returns all of the
+// entries from every page.
+func (l *conn) SearchPaged(req SearchRequest, pageSize int) ([]SearchResult, error) {
+	return l.SearchPagedContext(context.Background(), req, pageSize)
+}
+
+func (l *conn) SearchPagedContext(ctx context.Context, req SearchRequest, pageSize int) ([]SearchResult, error) {
+	results := []SearchResult{}
+	err := l.SearchPagedFunc(ctx, req, pageSize, func(page []SearchResult) error {
+		results = append(results, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// SearchPagedFunc performs req using the Simple Paged Results
+// control, requesting pageSize entries at a time, and calls fn with
+// each page as it arrives. If fn returns an error, the paged search
+// is cancelled and the error is returned.
+func (l *conn) SearchPagedFunc(ctx context.Context, req SearchRequest, pageSize int, fn func([]SearchResult) error) error {
+	var cookie []byte
+	for {
+		c, err := pagedResultsControl(pageSize, cookie)
+		if err != nil {
+			return err
+		}
+		results, controls, err := l.search(ctx, req, []control{c})
+		if err != nil {
+			return err
+		}
+		if cookie, err = pagedResultsCookie(controls); err != nil {
+			return err
+		}
+		if err = fn(results); err != nil {
+			if len(cookie) > 0 {
+				l.cancelPagedSearch(ctx, req, cookie)
+			}
+			return err
+		}
+		if len(cookie) == 0 {
+			return nil
+		}
+	}
+}
+
+// cancelPagedSearch tells the server to release the resources for a
+// paged search by asking for a page of size zero.
+func (l *conn) cancelPagedSearch(ctx context.Context, req SearchRequest, cookie []byte) {
+	c, err := pagedResultsControl(0, cookie)
+	if err != nil {
+		return
+	}
+	l.search(ctx, req, []control{c})
+}
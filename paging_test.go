@@ -0,0 +1,106 @@
+package ldap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stesla/ldap/asn1"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+// pagedServer serves a paged search over pages, checking that each
+// request asks for pageSize entries with the right cookie.
+func pagedServer(pageSize int, pages [][]string) func(s *testServer) {
+	return func(s *testServer) {
+		cookie := []byte{}
+		for i, page := range pages {
+			id, _, controls := s.readRequestControls()
+			c, ok := findControl(controls, pagedResultsOID)
+			if !assert.True(s.t, ok, "page %d: missing paged results control", i) {
+				return
+			}
+			var v pagedResultsValue
+			if !assert.NoError(s.t, asn1.NewDecoder(bytes.NewBuffer(c.Value)).Decode(&v)) {
+				return
+			}
+			assert.Equal(s.t, pageSize, v.Size, "page %d", i)
+			assert.Equal(s.t, cookie, v.Cookie, "page %d", i)
+
+			for _, dn := range page {
+				s.writeResponse(id, searchEntry(dn))
+			}
+			cookie = []byte{}
+			if i < len(pages)-1 {
+				cookie = []byte{byte(i + 1)}
+			}
+			resp, _ := pagedResultsControl(0, cookie)
+			s.writeResponse(id, searchDone(Success), resp)
+		}
+	}
+}
+
+var testPages = [][]string{
+	{"uid=alice,ou=users,dc=example,dc=org", "uid=bob,ou=users,dc=example,dc=org"},
+	{"uid=carol,ou=users,dc=example,dc=org", "uid=dave,ou=users,dc=example,dc=org"},
+	{"uid=eve,ou=users,dc=example,dc=org"},
+}
+
+var testPagedRequest = SearchRequest{
+	BaseObject: []byte("ou=users,dc=example,dc=org"),
+	Scope:      SingleLevel,
+	Filter:     Present("objectClass"),
+}
+
+func TestSearchPaged(t *testing.T) {
+	conn, wait := newTestConn(t, pagedServer(2, testPages))
+	defer wait()
+
+	results, err := conn.SearchPaged(testPagedRequest, 2)
+	if !assert.NoError(t, err) {
+		return
+	}
+	dns := []string{}
+	for _, r := range results {
+		dns = append(dns, r.DN)
+	}
+	assert.Equal(t, []string{
+		"uid=alice,ou=users,dc=example,dc=org",
+		"uid=bob,ou=users,dc=example,dc=org",
+		"uid=carol,ou=users,dc=example,dc=org",
+		"uid=dave,ou=users,dc=example,dc=org",
+		"uid=eve,ou=users,dc=example,dc=org",
+	}, dns)
+}
+
+func TestSearchPagedFuncStops(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readRequest()
+		s.writeResponse(id, searchEntry("uid=alice,ou=users,dc=example,dc=org"))
+		resp, _ := pagedResultsControl(0, []byte{1})
+		s.writeResponse(id, searchDone(Success), resp)
+
+		// The client should ask for a page of size zero to
+		// release the server's paging state.
+		id, _, controls := s.readRequestControls()
+		c, _ := findControl(controls, pagedResultsOID)
+		var v pagedResultsValue
+		if assert.NoError(t, asn1.NewDecoder(bytes.NewBuffer(c.Value)).Decode(&v)) {
+			assert.Equal(t, 0, v.Size)
+			assert.Equal(t, []byte{1}, v.Cookie)
+		}
+		resp, _ = pagedResultsControl(0, []byte{})
+		s.writeResponse(id, searchDone(Success), resp)
+	})
+	defer wait()
+
+	stop := errors.New("stop")
+	pages := 0
+	err := conn.SearchPagedFunc(context.Background(), testPagedRequest, 1, func(page []SearchResult) error {
+		pages++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, pages)
+}
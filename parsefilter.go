@@ -0,0 +1,327 @@
+package ldap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FilterError describes a problem parsing a filter string. Offset is
+// the byte offset in the string at which the problem was found.
+type FilterError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("LDAP filter error at offset %d: %s", e.Offset, e.Msg)
+}
+
+// ParseFilter parses the string representation of a filter defined
+// in RFC 4515, such as "(&(objectClass=posixAccount)(uid=al*))".
+func ParseFilter(s string) (Filter, error) {
+	p := &filterParser{s: s}
+	f, err := p.filter()
+	if err != nil {
+		return Filter{}, err
+	}
+	if !p.eof() {
+		return Filter{}, p.errorf("unexpected %q after filter", p.s[p.pos])
+	}
+	return f, nil
+}
+
+type filterParser struct {
+	s   string
+	pos int
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return p.errorAt(p.pos, format, args...)
+}
+
+func (p *filterParser) errorAt(pos int, format string, args ...interface{}) error {
+	return &FilterError{Offset: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *filterParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *filterParser) next(prefix string) bool {
+	if strings.HasPrefix(p.s[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(c byte) error {
+	if p.eof() {
+		return p.errorf("expected %q, found end of filter", c)
+	} else if p.s[p.pos] != c {
+		return p.errorf("expected %q, found %q", c, p.s[p.pos])
+	}
+	p.pos++
+	return nil
+}
+
+func (p *filterParser) filter() (f Filter, err error) {
+	if err = p.expect('('); err != nil {
+		return
+	}
+	switch {
+	case p.next("&"):
+		var filters []Filter
+		if filters, err = p.filterList(); err == nil {
+			f = And(filters...)
+		}
+	case p.next("|"):
+		var filters []Filter
+		if filters, err = p.filterList(); err == nil {
+			f = Or(filters...)
+		}
+	case p.next("!"):
+		if f, err = p.filter(); err == nil {
+			f = Not(f)
+		}
+	default:
+		f, err = p.item()
+	}
+	if err != nil {
+		return Filter{}, err
+	}
+	if err = p.expect(')'); err != nil {
+		return Filter{}, err
+	}
+	return f, nil
+}
+
+// filterList parses the filters of an and or an or. The list may be
+// empty, giving the absolute true and false filters of RFC 4526.
+func (p *filterParser) filterList() ([]Filter, error) {
+	var filters []Filter
+	for !p.eof() && p.s[p.pos] == '(' {
+		f, err := p.filter()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+func (p *filterParser) item() (Filter, error) {
+	start := p.pos
+	for !p.eof() && isAttributeChar(p.s[p.pos]) {
+		p.pos++
+	}
+	attr := p.s[start:p.pos]
+
+	if !p.eof() && p.s[p.pos] == ':' {
+		if attr != "" && !isAttributeDescription(attr) {
+			return Filter{}, p.errorAt(start, "invalid attribute description %q", attr)
+		}
+		return p.extensible(attr)
+	}
+
+	if attr == "" {
+		return Filter{}, p.errorf("expected attribute description")
+	} else if !isAttributeDescription(attr) {
+		return Filter{}, p.errorAt(start, "invalid attribute description %q", attr)
+	}
+
+	var makeFilter func(attribute, value string) Filter
+	switch {
+	case p.next("~="):
+		makeFilter = ApproxMatch
+	case p.next(">="):
+		makeFilter = GreaterOrEqual
+	case p.next("<="):
+		makeFilter = LessOrEqual
+	case p.next("="):
+		return p.equalityOrSubstring(attr)
+	default:
+		return Filter{}, p.errorf("expected filter type after attribute description")
+	}
+	value, err := p.value()
+	if err != nil {
+		return Filter{}, err
+	}
+	return makeFilter(attr, value), nil
+}
+
+// extensible parses the rest of an extensible match, after its
+// attribute description.
+func (p *filterParser) extensible(attr string) (Filter, error) {
+	start := p.pos
+	dn := false
+	if len(p.s)-p.pos > 3 && strings.EqualFold(p.s[p.pos:p.pos+3], ":dn") && p.s[p.pos+3] == ':' {
+		dn = true
+		p.pos += 3
+	}
+
+	var rule string
+	if !p.next(":=") {
+		p.pos++ // ':'
+		ruleStart := p.pos
+		for !p.eof() && isAttributeChar(p.s[p.pos]) && p.s[p.pos] != ';' {
+			p.pos++
+		}
+		rule = p.s[ruleStart:p.pos]
+		if !isOID(rule) {
+			return Filter{}, p.errorAt(ruleStart, "invalid matching rule %q", rule)
+		}
+		if !p.next(":=") {
+			return Filter{}, p.errorf("expected \":=\" in extensible match")
+		}
+	}
+
+	if attr == "" && rule == "" {
+		return Filter{}, p.errorAt(start, "extensible match requires an attribute or a matching rule")
+	}
+
+	value, err := p.value()
+	if err != nil {
+		return Filter{}, err
+	}
+	return extensibleMatch(rule, attr, value, dn), nil
+}
+
+// equalityOrSubstring parses the value of an equality, presence or
+// substrings filter, which are told apart by their unescaped '*'s.
+func (p *filterParser) equalityOrSubstring(attr string) (Filter, error) {
+	var values []string
+	var offsets []int
+	for {
+		offsets = append(offsets, p.pos)
+		value, err := p.valuePart()
+		if err != nil {
+			return Filter{}, err
+		}
+		values = append(values, value)
+		if !p.next("*") {
+			break
+		}
+	}
+
+	switch {
+	case len(values) == 1:
+		return Equals(attr, values[0]), nil
+	case len(values) == 2 && values[0] == "" && values[1] == "":
+		return Present(attr), nil
+	}
+
+	last := len(values) - 1
+	var substrings []substring
+	if values[0] != "" {
+		substrings = append(substrings, InitialSubstring(values[0]))
+	}
+	for i := 1; i < last; i++ {
+		if values[i] == "" {
+			return Filter{}, p.errorAt(offsets[i], "empty substring")
+		}
+		substrings = append(substrings, AnySubstring(values[i]))
+	}
+	if values[last] != "" {
+		substrings = append(substrings, FinalSubstring(values[last]))
+	}
+	return Substring(attr, substrings...), nil
+}
+
+// value parses an assertion value up to the closing parenthesis.
+func (p *filterParser) value() (string, error) {
+	value, err := p.valuePart()
+	if err == nil && !p.eof() && p.s[p.pos] == '*' {
+		err = p.errorf("unescaped '*' in value")
+	}
+	return value, err
+}
+
+// valuePart parses an assertion value up to the closing parenthesis
+// or the next unescaped '*', decoding any escapes.
+func (p *filterParser) valuePart() (string, error) {
+	var buf []byte
+	for !p.eof() {
+		switch c := p.s[p.pos]; c {
+		case ')', '*':
+			return string(buf), nil
+		case '(', 0:
+			return "", p.errorf("unescaped %q in value", c)
+		case '\\':
+			if len(p.s)-p.pos < 3 || !isHex(p.s[p.pos+1]) || !isHex(p.s[p.pos+2]) {
+				return "", p.errorf("escape must be followed by two hex digits")
+			}
+			buf = append(buf, unhex(p.s[p.pos+1])<<4|unhex(p.s[p.pos+2]))
+			p.pos += 3
+		default:
+			buf = append(buf, c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unexpected end of filter")
+}
+
+func isAttributeChar(c byte) bool {
+	return isAlpha(c) || isDigit(c) || c == '-' || c == '.' || c == ';'
+}
+
+// isAttributeDescription reports whether s is an attribute type
+// followed by any options, as in "cn;lang-en".
+func isAttributeDescription(s string) bool {
+	parts := strings.Split(s, ";")
+	if !isOID(parts[0]) {
+		return false
+	}
+	for _, option := range parts[1:] {
+		if option == "" {
+			return false
+		}
+		for i := 0; i < len(option); i++ {
+			if c := option[i]; !isAlpha(c) && !isDigit(c) && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isOID reports whether s is a descr or numericoid (RFC 4512 section
+// 1.4).
+func isOID(s string) bool {
+	if s == "" {
+		return false
+	}
+	if isAlpha(s[0]) {
+		for i := 1; i < len(s); i++ {
+			if c := s[i]; !isAlpha(c) && !isDigit(c) && c != '-' {
+				return false
+			}
+		}
+		return true
+	}
+	for _, number := range strings.Split(s, ".") {
+		if number == "" || (len(number) > 1 && number[0] == '0') {
+			return false
+		}
+		for i := 0; i < len(number); i++ {
+			if !isDigit(number[i]) {
+				return false
+			}
+		}
+	}
+	return strings.Contains(s, ".")
+}
+
+func isAlpha(c byte) bool { return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' }
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+func isHex(c byte) bool   { return isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F' }
+
+func unhex(c byte) byte {
+	switch {
+	case isDigit(c):
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
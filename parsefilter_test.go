@@ -0,0 +1,89 @@
+package ldap
+
+import (
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestParseFilter(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out Filter
+	}{
+		{"(cn=Alice Lastname)", Equals("cn", "Alice Lastname")},
+		{"(cn=)", Equals("cn", "")},
+		{"(objectClass=*)", Present("objectClass")},
+		{"(uidNumber>=1000)", GreaterOrEqual("uidNumber", "1000")},
+		{"(uidNumber<=1999)", LessOrEqual("uidNumber", "1999")},
+		{"(sn~=Lastnam)", ApproxMatch("sn", "Lastnam")},
+		{"(cn;lang-en=Alice)", Equals("cn;lang-en", "Alice")},
+		{"(2.5.4.3=Alice)", Equals("2.5.4.3", "Alice")},
+		{"(uid=al*)", Substring("uid", InitialSubstring("al"))},
+		{"(uid=*ce)", Substring("uid", FinalSubstring("ce"))},
+		{"(uid=*li*)", Substring("uid", AnySubstring("li"))},
+		{"(cn=A*i*e L*st*name)", Substring("cn",
+			InitialSubstring("A"), AnySubstring("i"), AnySubstring("e L"), AnySubstring("st"), FinalSubstring("name"))},
+		{`(cn=\2a\28\29\5c\00)`, Equals("cn", "*()\\\x00")},
+		{`(cn=*\2A*)`, Substring("cn", AnySubstring("*"))},
+		{`(sn=Lu\c4\8di\c4\87)`, Equals("sn", "Lučić")},
+		{"(cn:caseExactMatch:=Alice)", Matches("caseExactMatch", "cn", "Alice")},
+		{"(cn:=Alice)", Extensible(ExtensibleMatch{Attribute: "cn", Value: "Alice"})},
+		{"(ou:dn:=users)", Extensible(ExtensibleMatch{Attribute: "ou", Value: "users", DNAttributes: true})},
+		{"(o:dn:2.5.13.5:=example)", Extensible(ExtensibleMatch{MatchingRule: "2.5.13.5", Attribute: "o", Value: "example", DNAttributes: true})},
+		{"(:1.2.3:=Wilma Flintstone)", Extensible(ExtensibleMatch{MatchingRule: "1.2.3", Value: "Wilma Flintstone"})},
+		{"(:DN:2.4.6.8.10:=Dino)", Extensible(ExtensibleMatch{MatchingRule: "2.4.6.8.10", Value: "Dino", DNAttributes: true})},
+		{"(cn:dnQualifierMatch:=x)", Matches("dnQualifierMatch", "cn", "x")},
+		{"(!(uid=alice))", Not(Equals("uid", "alice"))},
+		{"(&)", And()},
+		{"(|)", Or()},
+		{"(&(objectClass=posixAccount)(uid=al*))", And(
+			Equals("objectClass", "posixAccount"),
+			Substring("uid", InitialSubstring("al")))},
+		{"(|(uid=alice)(&(uidNumber>=1000)(!(loginShell=/bin/false))))", Or(
+			Equals("uid", "alice"),
+			And(GreaterOrEqual("uidNumber", "1000"), Not(Equals("loginShell", "/bin/false")))),
+		},
+	}
+
+	for _, test := range tests {
+		f, err := ParseFilter(test.in)
+		if assert.NoError(t, err, test.in) {
+			assert.Equal(t, test.out, f, test.in)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	var tests = []struct {
+		in     string
+		offset int
+	}{
+		{"", 0},
+		{"cn=Alice", 0},
+		{"(cn=Alice", 9},
+		{"(cn=Alice))", 10},
+		{"(=Alice)", 1},
+		{"(cn Alice)", 3},
+		{"(1cn=Alice)", 1},
+		{"(cn;=Alice)", 1},
+		{"(cn=Al(ice)", 6},
+		{`(cn=Al\2)`, 6},
+		{`(cn=Al\zz)`, 6},
+		{"(cn>=Al*)", 7},
+		{"(cn=A**e)", 6},
+		{"(&(cn=Alice)", 12},
+		{"(!cn=Alice)", 2},
+		{"(:=Alice)", 1},
+		{"(cn:dn=Alice)", 6},
+		{"(cn:1.2.:=Alice)", 4},
+		{"(cn:rule=Alice)", 8},
+	}
+
+	for _, test := range tests {
+		_, err := ParseFilter(test.in)
+		if ferr, ok := err.(*FilterError); assert.True(t, ok, "%q: expected *FilterError, got %v", test.in, err) {
+			assert.Equal(t, test.offset, ferr.Offset, "%q: %v", test.in, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ldap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/stesla/ldap/asn1"
+)
+
+// The Password Modify extended operation, from RFC 3062.
+const passwordModifyOID = "1.3.6.1.4.1.4203.1.11.1"
+
+type passwordModifyRequest struct {
+	UserIdentity []byte `asn1:"tag:0,optional"`
+	OldPassword  []byte `asn1:"tag:1,optional"`
+	NewPassword  []byte `asn1:"tag:2,optional"`
+}
+
+type passwordModifyResponse struct {
+	GenPassword []byte `asn1:"tag:0,optional"`
+}
+
+// optionalBytes returns s as a byte slice, or nil if s is empty, so
+// that an optional field is left out.
+func optionalBytes(s string) []byte {
+	if s == "" {
+		return nil
+	}
+	return []byte(s)
+}
+
+// PasswordModify changes the password of the user named by userDN
+// from oldPassword to newPassword, letting the server hash it as it
+// sees fit. If userDN is empty, the password of the bound user is
+// changed. If oldPassword is empty, the server may allow the change
+// based on the bound user's authority. If newPassword is empty, the
+// server generates a new password, which is returned.
+func (l *conn) PasswordModify(userDN, oldPassword, newPassword string) (string, error) {
+	return l.PasswordModifyContext(context.Background(), userDN, oldPassword, newPassword)
+}
+
+func (l *conn) PasswordModifyContext(ctx context.Context, userDN, oldPassword, newPassword string) (string, error) {
+	var buf bytes.Buffer
+	enc := asn1.NewEncoder(&buf)
+	enc.Implicit = true
+	err := enc.Encode(passwordModifyRequest{
+		UserIdentity: optionalBytes(userDN),
+		OldPassword:  optionalBytes(oldPassword),
+		NewPassword:  optionalBytes(newPassword),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Encode: %v", err)
+	}
+
+	resp, err := l.ExtendedContext(ctx, passwordModifyOID, buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+	if resp.Value == nil {
+		return "", nil
+	}
+
+	var v passwordModifyResponse
+	dec := asn1.NewDecoder(bytes.NewBuffer(resp.Value))
+	dec.Implicit = true
+	if err := dec.Decode(&v); err != nil {
+		return "", fmt.Errorf("Decode password modify response: %v", err)
+	}
+	return string(v.GenPassword), nil
+}
@@ -0,0 +1,66 @@
+package ldap
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stesla/ldap/asn1"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestPasswordModify(t *testing.T) {
+	tests := []struct {
+		userDN, oldPassword, newPassword string
+		value                            []byte
+		generated                        string
+	}{
+		{"cn=alice,dc=example,dc=org", "old", "new", []byte{
+			0x30, 0x26,
+			0x80, 0x1a, 'c', 'n', '=', 'a', 'l', 'i', 'c', 'e', ',', 'd', 'c', '=', 'e', 'x', 'a', 'm', 'p', 'l', 'e', ',', 'd', 'c', '=', 'o', 'r', 'g',
+			0x81, 0x03, 'o', 'l', 'd',
+			0x82, 0x03, 'n', 'e', 'w',
+		}, ""},
+		{"", "old", "", []byte{0x30, 0x05, 0x81, 0x03, 'o', 'l', 'd'}, "s3cr3t"},
+		{"", "", "", []byte{0x30, 0x00}, "s3cr3t"},
+	}
+	for _, test := range tests {
+		func() {
+			conn, wait := newTestConn(t, func(s *testServer) {
+				id, op := s.readRequest()
+				var req extendedRequest
+				if s.decodeRequest(op, "application,tag:23", &req) {
+					assert.Equal(t, "1.3.6.1.4.1.4203.1.11.1", string(req.Name))
+					assert.Equal(t, test.value, req.Value)
+				}
+				resp := extendedResponse{}
+				if test.generated != "" {
+					var buf bytes.Buffer
+					enc := asn1.NewEncoder(&buf)
+					enc.Implicit = true
+					assert.NoError(t, enc.Encode(passwordModifyResponse{GenPassword: []byte(test.generated)}))
+					resp.Value = buf.Bytes()
+				}
+				s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:24", Value: resp})
+			})
+			defer wait()
+
+			generated, err := conn.PasswordModify(test.userDN, test.oldPassword, test.newPassword)
+			assert.NoError(t, err)
+			assert.Equal(t, test.generated, generated)
+		}()
+	}
+}
+
+func TestPasswordModifyError(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readRequest()
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:24", Value: extendedResponse{
+			Result: ldapResult{ResultCode: UnwillingToPerform, Message: []byte("password too short")},
+		}})
+	})
+	defer wait()
+
+	_, err := conn.PasswordModify("", "old", "new")
+	assert.True(t, errors.Is(err, UnwillingToPerform), "unexpected error: %v", err)
+}
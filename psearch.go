@@ -0,0 +1,185 @@
+package ldap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/stesla/ldap/asn1"
+)
+
+// The Persistent Search controls, from draft-ietf-ldapext-psearch.
+const (
+	persistentSearchOID = "2.16.840.1.113730.3.4.3"
+	entryChangeOID      = "2.16.840.1.113730.3.4.7"
+)
+
+// ChangeType is a set of kinds of change to an entry.
+type ChangeType int
+
+const (
+	ChangeAdd    ChangeType = 1
+	ChangeDelete ChangeType = 2
+	ChangeModify ChangeType = 4
+	ChangeModDN  ChangeType = 8
+
+	AnyChange = ChangeAdd | ChangeDelete | ChangeModify | ChangeModDN
+)
+
+var changeTypeNames = []struct {
+	t    ChangeType
+	name string
+}{
+	{ChangeAdd, "add"},
+	{ChangeDelete, "delete"},
+	{ChangeModify, "modify"},
+	{ChangeModDN, "modDN"},
+}
+
+func (t ChangeType) String() string {
+	var names []string
+	rest := t
+	for _, n := range changeTypeNames {
+		if t&n.t != 0 {
+			names = append(names, n.name)
+			rest &^= n.t
+		}
+	}
+	if rest != 0 || len(names) == 0 {
+		names = append(names, fmt.Sprintf("ChangeType(%d)", int(rest)))
+	}
+	return strings.Join(names, "|")
+}
+
+// PersistentSearchControl is the persistent search request control.
+// It asks the server to keep a search open after returning its
+// results, and to return each entry in scope that later changes in
+// one of the ways in ChangeTypes.
+type PersistentSearchControl struct {
+	ChangeTypes ChangeType
+
+	// ChangesOnly suppresses the entries that match the search when
+	// it begins, so that only changed entries are returned.
+	ChangesOnly bool
+
+	// ReturnECs asks the server to send an EntryChangeControl with
+	// each changed entry.
+	ReturnECs bool
+
+	Criticality bool
+}
+
+type persistentSearch struct {
+	ChangeTypes ChangeType
+	ChangesOnly bool
+	ReturnECs   bool
+}
+
+func (c PersistentSearchControl) OID() string    { return persistentSearchOID }
+func (c PersistentSearchControl) Critical() bool { return c.Criticality }
+
+func (c PersistentSearchControl) Value() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := asn1.NewEncoder(&buf)
+	err := enc.Encode(persistentSearch{c.ChangeTypes, c.ChangesOnly, c.ReturnECs})
+	if err != nil {
+		return nil, fmt.Errorf("Encode: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// EntryChangeControl is the entry change notification control, which
+// the server sends with an entry returned by a persistent search to
+// say how it changed.
+type EntryChangeControl struct {
+	// ChangeType is the single kind of change made to the entry.
+	ChangeType ChangeType
+
+	// PreviousDN is the entry's DN before a ChangeModDN.
+	PreviousDN string
+
+	// ChangeNumber is the number of the change in the server's
+	// change log, or 0 if the server does not say.
+	ChangeNumber int64
+
+	Criticality bool
+}
+
+type entryChange struct {
+	ChangeType   ChangeType `asn1:"enum"`
+	PreviousDN   []byte     `asn1:"optional"`
+	ChangeNumber int64      `asn1:"optional"`
+}
+
+func (c EntryChangeControl) OID() string    { return entryChangeOID }
+func (c EntryChangeControl) Critical() bool { return c.Criticality }
+
+func (c EntryChangeControl) Value() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := asn1.NewEncoder(&buf)
+	err := enc.Encode(entryChange{
+		ChangeType:   c.ChangeType,
+		PreviousDN:   optionalBytes(c.PreviousDN),
+		ChangeNumber: c.ChangeNumber,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Encode: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeEntryChangeControl(criticality bool, value []byte) (Control, error) {
+	var r entryChange
+	if err := asn1.NewDecoder(bytes.NewBuffer(value)).Decode(&r); err != nil {
+		return nil, err
+	}
+	return EntryChangeControl{
+		ChangeType:   r.ChangeType,
+		PreviousDN:   string(r.PreviousDN),
+		ChangeNumber: r.ChangeNumber,
+		Criticality:  criticality,
+	}, nil
+}
+
+func init() {
+	RegisterControl(entryChangeOID, decodeEntryChangeControl)
+}
+
+// EntryChange returns the EntryChangeControl sent with the current
+// entry of a persistent search. It returns false if there is none, as
+// for the entries that matched the search when it began.
+func (s *SearchStream) EntryChange() (EntryChangeControl, bool) {
+	c, ok := FindControl(s.entryControls, entryChangeOID).(EntryChangeControl)
+	return c, ok
+}
+
+// PersistentSearch begins a persistent search. The stream returns the
+// entries that match req, unless changesOnly is set, and then each
+// entry in scope that changes in one of the ways in changeTypes, with
+// its EntryChange. The persistent search control is critical, so a
+// server that does not support it fails the search. The search does
+// not end until ctx is cancelled or the stream is closed, when Err
+// returns ctx.Err() or nil respectively. The connection may be used
+// to react to each change from inside the loop.
+//
+//	s, err := conn.PersistentSearch(ctx, req, ldap.AnyChange, true)
+//	if err != nil {
+//		return err
+//	}
+//	defer s.Close()
+//	for s.Next() {
+//		if change, ok := s.EntryChange(); ok {
+//			...
+//		}
+//	}
+//	return s.Err()
+func (l *conn) PersistentSearch(ctx context.Context, req SearchRequest, changeTypes ChangeType, changesOnly bool) (*SearchStream, error) {
+	req.Controls = append(req.Controls[:len(req.Controls):len(req.Controls)], PersistentSearchControl{
+		ChangeTypes: changeTypes,
+		ChangesOnly: changesOnly,
+		ReturnECs:   true,
+		Criticality: true,
+	})
+	return l.SearchStream(ctx, req)
+}
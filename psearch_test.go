@@ -0,0 +1,184 @@
+package ldap
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestPersistentSearchControlValue(t *testing.T) {
+	value, err := PersistentSearchControl{ChangeTypes: ChangeAdd | ChangeModify, ReturnECs: true}.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x30, 0x09,
+		0x02, 0x01, 0x05,
+		0x01, 0x01, 0x00,
+		0x01, 0x01, 0xff,
+	}, value)
+}
+
+func TestEntryChangeControlRoundTrip(t *testing.T) {
+	value, err := EntryChangeControl{ChangeType: ChangeModDN, PreviousDN: "uid=old", ChangeNumber: 42}.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x30, 0x0f,
+		0x0a, 0x01, 0x08,
+		0x04, 0x07, 'u', 'i', 'd', '=', 'o', 'l', 'd',
+		0x02, 0x01, 0x2a,
+	}, value)
+
+	for _, c := range []EntryChangeControl{
+		{ChangeType: ChangeAdd},
+		{ChangeType: ChangeModify, ChangeNumber: 7, Criticality: true},
+		{ChangeType: ChangeModDN, PreviousDN: "uid=old,ou=users,dc=example,dc=org", ChangeNumber: 1 << 40},
+	} {
+		value, err := c.Value()
+		if !assert.NoError(t, err) {
+			continue
+		}
+		decoded, err := decodeEntryChangeControl(c.Criticality, value)
+		assert.NoError(t, err)
+		assert.Equal(t, c, decoded)
+	}
+}
+
+func TestChangeTypeString(t *testing.T) {
+	assert.Equal(t, "modDN", ChangeModDN.String())
+	assert.Equal(t, "add|delete|modify|modDN", AnyChange.String())
+	assert.Equal(t, "delete|ChangeType(16)", (ChangeDelete | 16).String())
+	assert.Equal(t, "ChangeType(0)", ChangeType(0).String())
+}
+
+// entryChangeControl returns the wire form of an entry change
+// notification control.
+func entryChangeControl(t *testing.T, c EntryChangeControl) control {
+	value, err := c.Value()
+	assert.NoError(t, err)
+	return control{Type: []byte(entryChangeOID), Value: value}
+}
+
+func TestPersistentSearch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _, controls := s.readRequestControls()
+		if assert.Len(t, controls, 1) {
+			value, _ := PersistentSearchControl{ChangeTypes: AnyChange, ReturnECs: true}.Value()
+			assert.Equal(t, control{Type: []byte(persistentSearchOID), Criticality: true, Value: value}, controls[0])
+		}
+		s.writeResponse(id, searchEntry("uid=alice,ou=users,dc=example,dc=org"))
+		s.writeResponse(id, searchEntry("uid=bob,ou=users,dc=example,dc=org"),
+			entryChangeControl(t, EntryChangeControl{ChangeType: ChangeAdd, ChangeNumber: 10}))
+		s.writeResponse(id, searchEntry("uid=carol,ou=users,dc=example,dc=org"),
+			entryChangeControl(t, EntryChangeControl{ChangeType: ChangeModDN, PreviousDN: "uid=alice,ou=users,dc=example,dc=org", ChangeNumber: 11}))
+
+		_, op := s.readRequest()
+		var abandoned int
+		if s.decodeRequest(op, "application,tag:16", &abandoned) {
+			assert.Equal(t, id, abandoned)
+		}
+	})
+	defer wait()
+
+	stream, err := conn.PersistentSearch(ctx, SearchRequest{
+		BaseObject: []byte("ou=users,dc=example,dc=org"),
+		Scope:      SingleLevel,
+		Filter:     Present("objectClass"),
+	}, AnyChange, false)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close()
+
+	if assert.True(t, stream.Next()) {
+		assert.Equal(t, "uid=alice,ou=users,dc=example,dc=org", stream.Entry().DN)
+		_, ok := stream.EntryChange()
+		assert.False(t, ok)
+	}
+	if assert.True(t, stream.Next()) {
+		assert.Equal(t, "uid=bob,ou=users,dc=example,dc=org", stream.Entry().DN)
+		change, ok := stream.EntryChange()
+		assert.True(t, ok)
+		assert.Equal(t, EntryChangeControl{ChangeType: ChangeAdd, ChangeNumber: 10}, change)
+	}
+	if assert.True(t, stream.Next()) {
+		assert.Equal(t, "uid=carol,ou=users,dc=example,dc=org", stream.Entry().DN)
+		change, ok := stream.EntryChange()
+		assert.True(t, ok)
+		assert.Equal(t, ChangeModDN, change.ChangeType)
+		assert.Equal(t, "uid=alice,ou=users,dc=example,dc=org", change.PreviousDN)
+		assert.Equal(t, int64(11), change.ChangeNumber)
+	}
+
+	cancel()
+	assert.False(t, stream.Next())
+	assert.Equal(t, context.Canceled, stream.Err())
+}
+
+func TestPersistentSearchUnsupported(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readRequest()
+		s.writeResponse(id, searchDone(UnavailableCriticalExtension))
+	})
+	defer wait()
+
+	stream, err := conn.PersistentSearch(context.Background(), testStreamRequest, ChangeAdd, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close()
+	assert.False(t, stream.Next())
+	assert.Error(t, stream.Err())
+	assert.Equal(t, UnavailableCriticalExtension, stream.Result().ResultCode)
+}
+
+func TestPersistentSearchReactToChange(t *testing.T) {
+	const changes = 40
+	conn, wait := newTestConn(t, func(s *testServer) {
+		psearchID, _ := s.readRequest()
+		for i := 0; i < changes; i++ {
+			s.writeResponse(psearchID, searchEntry(fmt.Sprintf("uid=user%d,ou=users,dc=example,dc=org", i)),
+				entryChangeControl(t, EntryChangeControl{ChangeType: ChangeAdd, ChangeNumber: int64(i)}))
+		}
+		id, op := s.readRequest()
+		var req testSearchRequest
+		if s.decodeRequest(op, "application,tag:3", &req) {
+			assert.Equal(t, "cn=users,ou=groups,dc=example,dc=org", string(req.BaseObject))
+		}
+		s.writeResponse(id, searchEntry("cn=users,ou=groups,dc=example,dc=org"))
+		s.writeResponse(id, searchDone(Success))
+
+		_, op = s.readRequest()
+		var abandoned int
+		if s.decodeRequest(op, "application,tag:16", &abandoned) {
+			assert.Equal(t, psearchID, abandoned)
+		}
+	})
+	defer wait()
+
+	stream, err := conn.PersistentSearch(context.Background(), testStreamRequest, ChangeAdd, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close()
+
+	n := 0
+	for n < changes && stream.Next() {
+		change, ok := stream.EntryChange()
+		assert.True(t, ok)
+		assert.Equal(t, int64(n), change.ChangeNumber)
+		if n == 0 {
+			results, err := conn.Search(SearchRequest{
+				BaseObject: []byte("cn=users,ou=groups,dc=example,dc=org"),
+				Scope:      BaseObject,
+				Filter:     Equals("member", stream.Entry().DN),
+			})
+			assert.NoError(t, err)
+			assert.Len(t, results, 1)
+		}
+		n++
+	}
+	assert.Equal(t, changes, n)
+}
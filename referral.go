@@ -0,0 +1,191 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+)
+
+// ReferralDialer connects to the server named by a referral URL. It
+// is responsible for securing and binding the connection as needed.
+type ReferralDialer func(ctx context.Context, u *URL) (Conn, error)
+
+var (
+	ErrReferralLimit = LDAPError{"referral hop limit exceeded"}
+	ErrReferralLoop  = LDAPError{"referral loop detected"}
+)
+
+type referralChaser struct {
+	dial    ReferralDialer
+	maxHops int
+}
+
+// ChaseReferrals turns on referral chasing for Search, Add, Modify,
+// Delete, ModifyDN and Compare. Referrals are followed by connecting
+// with dial and repeating the operation there, through at most
+// maxHops servers. If dial is nil, referral chasing is turned off and
+// referrals are returned to the caller.
+func (l *conn) ChaseReferrals(dial ReferralDialer, maxHops int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if dial == nil {
+		l.chaser = nil
+	} else {
+		l.chaser = &referralChaser{dial: dial, maxHops: maxHops}
+	}
+}
+
+func (l *conn) referralChaser() *referralChaser {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.chaser
+}
+
+type referralStateKey struct{}
+
+// referralState is the chain of referrals followed so far, carried
+// in the context so that nested referrals are counted.
+type referralState struct {
+	hops    int
+	visited map[string]bool
+}
+
+func (st referralState) next(key string) referralState {
+	visited := make(map[string]bool, len(st.visited)+1)
+	for k := range st.visited {
+		visited[k] = true
+	}
+	visited[key] = true
+	return referralState{hops: st.hops + 1, visited: visited}
+}
+
+// follow calls fn on a connection to the first of urls that can be
+// reached. The URLs are alternatives, so once fn has run on one of
+// them the rest are ignored.
+func (ch *referralChaser) follow(ctx context.Context, urls []string, fn func(ctx context.Context, c Conn, u *URL) error) error {
+	st, _ := ctx.Value(referralStateKey{}).(referralState)
+	if st.hops >= ch.maxHops {
+		return ErrReferralLimit
+	}
+
+	var err error = ErrReferralLoop
+	for _, s := range urls {
+		var u *URL
+		if u, err = ParseURL(s); err != nil {
+			continue
+		}
+		key := u.key()
+		if st.visited[key] {
+			err = ErrReferralLoop
+			continue
+		}
+		var c Conn
+		if c, err = ch.dial(ctx, u); err != nil {
+			continue
+		}
+		err = fn(context.WithValue(ctx, referralStateKey{}, st.next(key)), c, u)
+		c.Unbind()
+		return err
+	}
+	return err
+}
+
+// retry repeats an operation on dn at the servers named by urls,
+// following any further referrals it returns.
+func (ch *referralChaser) retry(ctx context.Context, urls []string, dn string, op func(ctx context.Context, c Conn, dn string) error) error {
+	return ch.follow(ctx, urls, func(ctx context.Context, c Conn, u *URL) error {
+		target := dn
+		if u.DN != "" {
+			target = u.DN
+		}
+		err := op(ctx, c, target)
+		if urls := referralURLs(err); urls != nil {
+			return ch.retry(ctx, urls, target, op)
+		}
+		return err
+	})
+}
+
+// referralURLs returns the URLs from err if it is a referral result.
+func referralURLs(err error) []string {
+	var rerr *ResultError
+	if errors.As(err, &rerr) && rerr.ResultCode == Referral && len(rerr.Referral) > 0 {
+		return rerr.Referral
+	}
+	return nil
+}
+
+// chase retries op elsewhere if err is a referral and referral
+// chasing is on. Otherwise it returns err.
+func (l *conn) chase(ctx context.Context, err error, dn string, op func(ctx context.Context, c Conn, dn string) error) error {
+	ch := l.referralChaser()
+	urls := referralURLs(err)
+	if ch == nil || urls == nil {
+		return err
+	}
+	return ch.retry(ctx, urls, dn, op)
+}
+
+// searchRequest returns req retargeted at u, as described in RFC 4511
+// section 4.5.3.
+func (u *URL) searchRequest(req SearchRequest) (SearchRequest, error) {
+	// The controls were meant for the server the search was sent
+	// to, which may not be the one u names.
+	req.Controls = nil
+	if u.DN != "" {
+		req.BaseObject = []byte(u.DN)
+	}
+	if u.HasScope {
+		req.Scope = u.Scope
+	}
+	if u.Filter != "" {
+		f, err := ParseFilter(u.Filter)
+		if err != nil {
+			return req, err
+		}
+		req.Filter = f
+	}
+	return req, nil
+}
+
+// collectSearch reads every entry from s. Continuation references
+// and referral results are followed if ch is not nil, and otherwise
+// references are returned as results.
+func collectSearch(ctx context.Context, ch *referralChaser, req SearchRequest, s *SearchStream) ([]SearchResult, error) {
+	defer s.Close()
+
+	results := []SearchResult{}
+	for s.Next() {
+		if entry := s.Entry(); entry != nil {
+			results = append(results, *entry)
+		} else if ch == nil {
+			results = append(results, SearchResult{References: s.Reference()})
+		} else {
+			more, err := ch.search(ctx, req, s.Reference())
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, more...)
+		}
+	}
+
+	if urls := referralURLs(s.Err()); urls != nil && ch != nil {
+		return ch.search(ctx, req, urls)
+	}
+	return results, s.Err()
+}
+
+func (ch *referralChaser) search(ctx context.Context, req SearchRequest, urls []string) (results []SearchResult, err error) {
+	err = ch.follow(ctx, urls, func(ctx context.Context, c Conn, u *URL) error {
+		req, err := u.searchRequest(req)
+		if err != nil {
+			return err
+		}
+		s, err := c.SearchStream(ctx, req)
+		if err != nil {
+			return err
+		}
+		results, err = collectSearch(ctx, ch, req, s)
+		return err
+	})
+	return
+}
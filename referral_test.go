@@ -0,0 +1,214 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stesla/ldap/asn1"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+// testDialer returns a ReferralDialer that connects to a testServer
+// running the serve function registered for the URL's host.
+type testDialer struct {
+	t     *testing.T
+	serve map[string]func(s *testServer)
+
+	mu    sync.Mutex
+	waits []func()
+	dials []string
+}
+
+func (d *testDialer) dial(ctx context.Context, u *URL) (Conn, error) {
+	serve, ok := d.serve[u.Host]
+	if !ok {
+		return nil, errors.New("no such host " + u.Host)
+	}
+	c, wait := newTestConn(d.t, serve)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.waits = append(d.waits, wait)
+	d.dials = append(d.dials, u.Host)
+	return c, nil
+}
+
+func (d *testDialer) wait() {
+	for _, wait := range d.waits {
+		wait()
+	}
+}
+
+func referralResult(urls ...string) ldapResult {
+	return ldapResult{ResultCode: Referral, Referral: makeValues(urls)}
+}
+
+func TestSearchReturnsReferences(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readRequest()
+		s.writeResponse(id, searchEntry("uid=alice,ou=users,dc=example,dc=org"))
+		s.writeResponse(id, searchReference("ldap://ldap2/ou=groups,dc=example,dc=org"))
+		s.writeResponse(id, searchDone(Success))
+	})
+	defer wait()
+
+	results, err := conn.Search(testStreamRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, []SearchResult{
+		{DN: "uid=alice,ou=users,dc=example,dc=org", Attributes: map[string][]string{}},
+		{References: []string{"ldap://ldap2/ou=groups,dc=example,dc=org"}},
+	}, results)
+}
+
+func TestSearchChasesReferences(t *testing.T) {
+	d := &testDialer{t: t, serve: map[string]func(*testServer){
+		"ldap2": func(s *testServer) {
+			id, op := s.readRequest()
+			var req testSearchRequest
+			if s.decodeRequest(op, "application,tag:3", &req) {
+				assert.Equal(t, "ou=groups,dc=example,dc=org", string(req.BaseObject))
+				assert.Equal(t, int(BaseObject), req.Scope)
+				assert.Equal(t, asn1.ClassContextSpecific, req.Filter.Class)
+				assert.Equal(t, 7, req.Filter.Tag, "expected a present filter")
+				assert.Equal(t, "ou", string(req.Filter.Bytes))
+			}
+			s.writeResponse(id, searchEntry("ou=groups,dc=example,dc=org"))
+			s.writeResponse(id, searchDone(Success))
+			s.readRequest() // unbind
+		},
+		"ldap3": func(s *testServer) {
+			id, _ := s.readRequest()
+			s.writeResponse(id, searchDone(NoSuchObject))
+		},
+	}}
+	defer d.wait()
+
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readRequest()
+		s.writeResponse(id, searchEntry("uid=alice,ou=users,dc=example,dc=org"))
+		s.writeResponse(id, searchReference("ldap://unreachable/", "ldap://ldap2/ou=groups,dc=example,dc=org??base?(ou=*)", "ldap://ldap3/"))
+		s.writeResponse(id, searchDone(Success))
+	})
+	defer wait()
+
+	conn.ChaseReferrals(d.dial, 5)
+	results, err := conn.Search(testStreamRequest)
+	assert.NoError(t, err)
+	dns := []string{}
+	for _, r := range results {
+		dns = append(dns, r.DN)
+	}
+	assert.Equal(t, []string{"uid=alice,ou=users,dc=example,dc=org", "ou=groups,dc=example,dc=org"}, dns)
+	assert.Equal(t, []string{"ldap2"}, d.dials)
+}
+
+func TestDeleteChasesReferral(t *testing.T) {
+	d := &testDialer{t: t, serve: map[string]func(*testServer){
+		"master": func(s *testServer) {
+			id, op := s.readRequest()
+			assert.Equal(t, "cn=Alice Lastname,ou=users,dc=example,dc=org", string(op.Bytes))
+			s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:11", Value: ldapResult{}})
+		},
+	}}
+	defer d.wait()
+
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readRequest()
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:11", Value: referralResult("ldap://master/")})
+	})
+	defer wait()
+
+	conn.ChaseReferrals(d.dial, 5)
+	assert.NoError(t, conn.Delete("cn=Alice Lastname,ou=users,dc=example,dc=org"))
+	assert.Equal(t, []string{"master"}, d.dials)
+}
+
+func TestReferralDoesNotForwardControls(t *testing.T) {
+	d := &testDialer{t: t, serve: map[string]func(*testServer){
+		"ldap2": func(s *testServer) {
+			id, _, controls := s.readRequestControls()
+			assert.Empty(t, controls)
+			s.writeResponse(id, searchEntry("ou=groups,dc=example,dc=org"))
+			s.writeResponse(id, searchDone(Success))
+			s.readRequest() // unbind
+		},
+		"master": func(s *testServer) {
+			id, _, controls := s.readRequestControls()
+			assert.Empty(t, controls)
+			s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:11", Value: ldapResult{}})
+			s.readRequest() // unbind
+		},
+	}}
+	defer d.wait()
+
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _, controls := s.readRequestControls()
+		assert.Len(t, controls, 1)
+		s.writeResponse(id, searchReference("ldap://ldap2/ou=groups,dc=example,dc=org"))
+		s.writeResponse(id, searchDone(Success), sortResultControl(t, Success, ""))
+
+		id, _, controls = s.readRequestControls()
+		assert.Len(t, controls, 1)
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:11", Value: referralResult("ldap://master/")})
+	})
+	defer wait()
+
+	conn.ChaseReferrals(d.dial, 5)
+	results, err := conn.SearchSorted(testStreamRequest, SortKey{Attribute: "ou"})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	_, err = conn.DeleteWithControls(context.Background(), "cn=Alice Lastname,ou=users,dc=example,dc=org",
+		[]Control{RawControl{Type: "1.2.3.4", Criticality: true}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ldap2", "master"}, d.dials)
+}
+
+func TestReferralLoopAndLimit(t *testing.T) {
+	refer := func(url string) func(s *testServer) {
+		return func(s *testServer) {
+			id, _ := s.readRequest()
+			s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:15", Value: referralResult(url)})
+		}
+	}
+	d := &testDialer{t: t, serve: map[string]func(*testServer){
+		"a": refer("ldap://b/"),
+		"b": refer("ldap://a/"),
+	}}
+	defer d.wait()
+
+	var tests = []struct {
+		maxHops  int
+		expected error
+	}{
+		{5, ErrReferralLoop},
+		{1, ErrReferralLimit},
+	}
+
+	for _, test := range tests {
+		func() {
+			conn, wait := newTestConn(t, refer("ldap://a/"))
+			defer wait()
+
+			conn.ChaseReferrals(d.dial, test.maxHops)
+			_, err := conn.Compare("cn=users,ou=groups,dc=example,dc=org", "memberUid", "alice")
+			assert.Equal(t, test.expected, err)
+		}()
+	}
+}
+
+func TestReferralNotChased(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readRequest()
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:7", Value: referralResult("ldap://master/")})
+	})
+	defer wait()
+
+	err := conn.Modify("cn=Alice Lastname,ou=users,dc=example,dc=org", nil)
+	var rerr *ResultError
+	if assert.True(t, errors.As(err, &rerr)) {
+		assert.Equal(t, Referral, rerr.ResultCode)
+		assert.Equal(t, []string{"ldap://master/"}, rerr.Referral)
+	}
+}
@@ -0,0 +1,140 @@
+package ldap
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+
+	"github.com/stesla/ldap/asn1"
+)
+
+// SASLMechanism is a SASL authentication mechanism (RFC 4422) used by
+// SASLBind.
+type SASLMechanism interface {
+	// Start begins the exchange, returning the name of the
+	// mechanism and the initial response to send with it, which is
+	// nil if the mechanism has none.
+	Start() (name string, initial []byte, err error)
+
+	// Next is called with each challenge from the server and
+	// returns the response. If more is false, the server has
+	// completed the bind successfully and challenge holds any
+	// additional data it sent with the result, which the mechanism
+	// may verify, returning an error if it is not satisfied.
+	Next(challenge []byte, more bool) (response []byte, err error)
+}
+
+type saslCredentials struct {
+	Mechanism   []byte
+	Credentials []byte `asn1:"optional"`
+}
+
+func saslAuth(mechanism string, credentials []byte) interface{} {
+	return asn1.OptionValue{Opts: "tag:3", Value: saslCredentials{
+		Mechanism:   []byte(mechanism),
+		Credentials: credentials,
+	}}
+}
+
+// SASLBind authenticates with mechanism, exchanging as many bind
+// requests with the server as the mechanism needs.
+func (l *conn) SASLBind(mechanism SASLMechanism) error {
+	return l.SASLBindContext(context.Background(), mechanism)
+}
+
+// SASLBindContext is like SASLBind. Bind requests cannot be abandoned,
+// so if ctx is done first, the outcome of the bind is unknown.
+func (l *conn) SASLBindContext(ctx context.Context, mechanism SASLMechanism) error {
+	_, err := l.SASLBindWithControls(ctx, mechanism, nil)
+	return err
+}
+
+// SASLBindWithControls is like SASLBindContext, but sends controls with
+// each bind request of the exchange and returns the controls from the
+// last response, even if the bind fails.
+func (l *conn) SASLBindWithControls(ctx context.Context, mechanism SASLMechanism, controls []Control) ([]Control, error) {
+	if binder, ok := mechanism.(SASLChannelBinder); ok {
+		if tlsConn, ok := l.Conn.(*tls.Conn); ok {
+			binder.SetTLSState(tlsConn.ConnectionState())
+		}
+	}
+
+	name, credentials, err := mechanism.Start()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		resp, respControls, err := l.bind(ctx, "", saslAuth(name, credentials), controls)
+		if err != nil {
+			return nil, err
+		}
+		switch resp.Result.ResultCode {
+		case SaslBindInProgress:
+			credentials, err = mechanism.Next(resp.ServerSaslCreds, true)
+			if err != nil {
+				return respControls, err
+			}
+		case Success:
+			_, err = mechanism.Next(resp.ServerSaslCreds, false)
+			return respControls, err
+		default:
+			return respControls, resp.Result.err()
+		}
+	}
+}
+
+// saslNonce returns a random client nonce for a SASL exchange.
+func saslNonce() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+type plainMechanism struct {
+	authzid, username, password string
+}
+
+// SASLPlain returns the PLAIN mechanism (RFC 4616), which authenticates
+// username with password and acts as authzid, if it is not empty.
+// PLAIN sends the password in the clear, so it should only be used
+// over TLS.
+func SASLPlain(authzid, username, password string) SASLMechanism {
+	return &plainMechanism{authzid, username, password}
+}
+
+func (m *plainMechanism) Start() (string, []byte, error) {
+	return "PLAIN", []byte(m.authzid + "\x00" + m.username + "\x00" + m.password), nil
+}
+
+func (m *plainMechanism) Next(challenge []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, LDAPError{"unexpected challenge for SASL PLAIN"}
+	}
+	return nil, nil
+}
+
+type externalMechanism struct {
+	authzid string
+}
+
+// SASLExternal returns the EXTERNAL mechanism (RFC 4422 appendix A),
+// which authenticates with credentials established outside of LDAP,
+// such as the client certificate presented during StartTLS or
+// DialSSL, and acts as authzid, if it is not empty.
+func SASLExternal(authzid string) SASLMechanism {
+	return &externalMechanism{authzid}
+}
+
+func (m *externalMechanism) Start() (string, []byte, error) {
+	return "EXTERNAL", []byte(m.authzid), nil
+}
+
+func (m *externalMechanism) Next(challenge []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, LDAPError{"unexpected challenge for SASL EXTERNAL"}
+	}
+	return nil, nil
+}
@@ -0,0 +1,158 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"github.com/stesla/ldap/asn1"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+type testBindRequest struct {
+	Version int8
+	Name    []byte
+	Auth    asn1.RawValue
+}
+
+// readSASLBind reads a SASL bind request from the client, returning
+// its message id and credentials.
+func (s *testServer) readSASLBind() (id int, creds saslCredentials) {
+	id, op := s.readRequest()
+	var req testBindRequest
+	if !s.decodeRequest(op, "application,tag:0", &req) {
+		return
+	}
+	assert.Equal(s.t, 3, int(req.Version))
+	assert.Equal(s.t, "", string(req.Name))
+	s.decodeRequest(req.Auth, "tag:3", &creds)
+	return
+}
+
+func (s *testServer) writeBindResponse(id int, code ResultCode, creds []byte) {
+	s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:1", Value: bindResponse{
+		Result:          ldapResult{ResultCode: code},
+		ServerSaslCreds: creds,
+	}})
+}
+
+// fixedNonce returns a nonce generator for a SASL mechanism that always
+// returns nonce.
+func fixedNonce(nonce string) func() (string, error) {
+	return func() (string, error) { return nonce, nil }
+}
+
+// scriptedMechanism is a SASLMechanism that sends responses from a
+// script and records the challenges it receives.
+type scriptedMechanism struct {
+	initial    []byte
+	responses  [][]byte
+	challenges [][]byte
+	done       bool
+}
+
+func (m *scriptedMechanism) Start() (string, []byte, error) {
+	return "TEST", m.initial, nil
+}
+
+func (m *scriptedMechanism) Next(challenge []byte, more bool) ([]byte, error) {
+	m.challenges = append(m.challenges, challenge)
+	if !more {
+		m.done = true
+		return nil, nil
+	}
+	resp := m.responses[0]
+	m.responses = m.responses[1:]
+	return resp, nil
+}
+
+func TestSASLBindPlain(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, creds := s.readSASLBind()
+		assert.Equal(t, "PLAIN", string(creds.Mechanism))
+		assert.Equal(t, "admin\x00alice\x00secret", string(creds.Credentials))
+		s.writeBindResponse(id, Success, nil)
+	})
+	defer wait()
+
+	assert.NoError(t, conn.SASLBind(SASLPlain("admin", "alice", "secret")))
+}
+
+func TestSASLBindMultiStep(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, creds := s.readSASLBind()
+		assert.Equal(t, "TEST", string(creds.Mechanism))
+		assert.Nil(t, creds.Credentials)
+		s.writeBindResponse(id, SaslBindInProgress, []byte("challenge 1"))
+
+		id, creds = s.readSASLBind()
+		assert.Equal(t, "response 1", string(creds.Credentials))
+		s.writeBindResponse(id, SaslBindInProgress, []byte("challenge 2"))
+
+		id, creds = s.readSASLBind()
+		assert.Equal(t, "response 2", string(creds.Credentials))
+		s.writeBindResponse(id, Success, []byte("outcome"))
+	})
+	defer wait()
+
+	m := &scriptedMechanism{responses: [][]byte{[]byte("response 1"), []byte("response 2")}}
+	assert.NoError(t, conn.SASLBind(m))
+	assert.True(t, m.done)
+	assert.Equal(t, [][]byte{[]byte("challenge 1"), []byte("challenge 2"), []byte("outcome")}, m.challenges)
+}
+
+func TestSASLBindFailure(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readSASLBind()
+		s.writeBindResponse(id, SaslBindInProgress, []byte("challenge"))
+		id, _ = s.readSASLBind()
+		s.writeBindResponse(id, InvalidCredentials, nil)
+	})
+	defer wait()
+
+	m := &scriptedMechanism{initial: []byte("hello"), responses: [][]byte{[]byte("response")}}
+	err := conn.SASLBind(m)
+	assert.True(t, errors.Is(err, InvalidCredentials), "unexpected error: %v", err)
+	assert.False(t, m.done)
+}
+
+func TestSASLBindPlainRejectsChallenge(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readSASLBind()
+		s.writeBindResponse(id, SaslBindInProgress, []byte("challenge"))
+	})
+	defer wait()
+
+	assert.Error(t, conn.SASLBind(SASLPlain("", "alice", "secret")))
+}
+
+func TestSASLBindExternalAfterStartTLS(t *testing.T) {
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t, "localhost")},
+		ClientAuth:   tls.RequireAnyClientCert,
+	}
+	conn, wait := newTestConn(t, func(s *testServer) {
+		if !s.startTestTLS(serverConfig) {
+			return
+		}
+		peers := s.Conn.(*tls.Conn).ConnectionState().PeerCertificates
+		if assert.Len(t, peers, 1) {
+			assert.Equal(t, "alice", peers[0].Subject.CommonName)
+		}
+
+		id, creds := s.readSASLBind()
+		assert.Equal(t, "EXTERNAL", string(creds.Mechanism))
+		assert.Equal(t, []byte{}, creds.Credentials)
+		s.writeBindResponse(id, Success, nil)
+	})
+	defer wait()
+
+	err := conn.StartTLS(&tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{testCertificate(t, "alice")},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, conn.SASLBind(SASLExternal("")))
+}
@@ -0,0 +1,265 @@
+package ldap
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// SASLChannelBinder is implemented by SASL mechanisms that can bind
+// authentication to the TLS connection it happens over (RFC 5056).
+// SASLBind calls SetTLSState before Start if the connection uses TLS,
+// either from DialSSL or after StartTLS.
+type SASLChannelBinder interface {
+	SASLMechanism
+	SetTLSState(state tls.ConnectionState)
+}
+
+// SASLScramSHA1 returns the SCRAM-SHA-1 mechanism (RFC 5802), which
+// authenticates username with password without sending the password
+// to the server, and acts as authzid, if it is not empty. The
+// server's signature is verified when the bind completes.
+//
+// It does not bind authentication to the TLS connection, if there is
+// one, and tells the server so. Use SASLScramSHA1Plus for that.
+//
+// The password is used as given, without SASLprep.
+func SASLScramSHA1(authzid, username, password string) SASLMechanism {
+	return &scramMechanism{name: "SCRAM-SHA-1", hash: sha1.New, authzid: authzid, username: username, password: password, newNonce: saslNonce}
+}
+
+// SASLScramSHA1Plus is like SASLScramSHA1, but binds authentication to
+// the TLS connection with the tls-unique channel binding or, where
+// that is not available, as with TLS 1.3, tls-server-end-point (RFC
+// 5929). It fails if the connection does not use TLS.
+func SASLScramSHA1Plus(authzid, username, password string) SASLMechanism {
+	return &scramMechanism{name: "SCRAM-SHA-1-PLUS", hash: sha1.New, authzid: authzid, username: username, password: password, plus: true, newNonce: saslNonce}
+}
+
+// SASLScramSHA256 is like SASLScramSHA1, but uses SHA-256 (RFC 7677).
+func SASLScramSHA256(authzid, username, password string) SASLMechanism {
+	return &scramMechanism{name: "SCRAM-SHA-256", hash: sha256.New, authzid: authzid, username: username, password: password, newNonce: saslNonce}
+}
+
+// SASLScramSHA256Plus is like SASLScramSHA1Plus, but uses SHA-256.
+func SASLScramSHA256Plus(authzid, username, password string) SASLMechanism {
+	return &scramMechanism{name: "SCRAM-SHA-256-PLUS", hash: sha256.New, authzid: authzid, username: username, password: password, plus: true, newNonce: saslNonce}
+}
+
+type scramMechanism struct {
+	name                        string
+	hash                        func() hash.Hash
+	authzid, username, password string
+	plus                        bool
+	tlsState                    *tls.ConnectionState
+
+	// newNonce generates the client nonce for each exchange.
+	newNonce func() (string, error)
+
+	nonce           string
+	gs2Header       string
+	clientFirstBare string
+	serverSignature []byte
+	verified        bool
+}
+
+func (m *scramMechanism) SetTLSState(state tls.ConnectionState) {
+	m.tlsState = &state
+}
+
+func (m *scramMechanism) Start() (string, []byte, error) {
+	m.serverSignature, m.verified = nil, false
+	switch {
+	case m.plus && m.tlsState == nil:
+		return "", nil, LDAPError{m.name + " requires a TLS connection"}
+	case m.plus:
+		m.gs2Header = "p=" + m.channelBindingType() + ","
+	default:
+		// Not "y", even over TLS: a server that supports channel
+		// binding must reject it (RFC 5802 section 6).
+		m.gs2Header = "n,"
+	}
+	if m.authzid != "" {
+		m.gs2Header += "a=" + scramName(m.authzid)
+	}
+	m.gs2Header += ","
+
+	nonce, err := m.newNonce()
+	if err != nil {
+		return "", nil, err
+	}
+	m.nonce = nonce
+	m.clientFirstBare = "n=" + scramName(m.username) + ",r=" + m.nonce
+	return m.name, []byte(m.gs2Header + m.clientFirstBare), nil
+}
+
+func (m *scramMechanism) Next(challenge []byte, more bool) ([]byte, error) {
+	switch {
+	case m.serverSignature == nil && more:
+		return m.clientFinal(string(challenge))
+	case m.serverSignature == nil:
+		return nil, LDAPError{m.name + " bind completed before authentication"}
+	case !m.verified && len(challenge) == 0:
+		return nil, LDAPError{m.name + " server did not send its signature"}
+	case !m.verified:
+		if err := m.verify(string(challenge)); err != nil {
+			return nil, err
+		}
+		// The server may send its signature as a challenge, in
+		// which case it expects an empty response.
+		return []byte{}, nil
+	case more:
+		return nil, LDAPError{"unexpected challenge for " + m.name}
+	}
+	return nil, nil
+}
+
+// clientFinal returns the client-final-message in response to
+// serverFirst, and computes the signature expected from the server.
+func (m *scramMechanism) clientFinal(serverFirst string) ([]byte, error) {
+	attrs, err := scramAttributes(serverFirst)
+	if err != nil {
+		return nil, err
+	}
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, m.nonce) || len(nonce) == len(m.nonce) {
+		return nil, LDAPError{m.name + " server nonce does not extend the client nonce"}
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil || len(salt) == 0 {
+		return nil, LDAPError{m.name + " server sent an invalid salt"}
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations < 1 {
+		return nil, LDAPError{m.name + " server sent an invalid iteration count"}
+	}
+
+	cbind := []byte(m.gs2Header)
+	if m.plus {
+		data, err := m.channelBindingData()
+		if err != nil {
+			return nil, err
+		}
+		cbind = append(cbind, data...)
+	}
+	withoutProof := "c=" + base64.StdEncoding.EncodeToString(cbind) + ",r=" + nonce
+	authMessage := []byte(m.clientFirstBare + "," + serverFirst + "," + withoutProof)
+
+	saltedPassword := scramHi(m.hash, []byte(m.password), salt, iterations)
+	clientKey := m.hmac(saltedPassword, []byte("Client Key"))
+	h := m.hash()
+	h.Write(clientKey)
+	storedKey := h.Sum(nil)
+	proof := m.hmac(storedKey, authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	serverKey := m.hmac(saltedPassword, []byte("Server Key"))
+	m.serverSignature = m.hmac(serverKey, authMessage)
+
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// verify checks the server signature in serverFinal.
+func (m *scramMechanism) verify(serverFinal string) error {
+	attrs, err := scramAttributes(serverFinal)
+	if err != nil {
+		return err
+	}
+	if e, ok := attrs["e"]; ok {
+		return LDAPError{m.name + " server error: " + e}
+	}
+	signature, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil || !hmac.Equal(signature, m.serverSignature) {
+		return LDAPError{m.name + " server signature does not match"}
+	}
+	m.verified = true
+	return nil
+}
+
+func (m *scramMechanism) hmac(key, data []byte) []byte {
+	mac := hmac.New(m.hash, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (m *scramMechanism) channelBindingType() string {
+	if m.tlsState.TLSUnique != nil {
+		return "tls-unique"
+	}
+	return "tls-server-end-point"
+}
+
+func (m *scramMechanism) channelBindingData() ([]byte, error) {
+	if m.tlsState.TLSUnique != nil {
+		return m.tlsState.TLSUnique, nil
+	}
+	if len(m.tlsState.PeerCertificates) == 0 {
+		return nil, LDAPError{m.name + " requires a server certificate for channel binding"}
+	}
+	return tlsServerEndPoint(m.tlsState.PeerCertificates[0]), nil
+}
+
+// tlsServerEndPoint returns the tls-server-end-point channel binding
+// data for cert, the hash of the certificate using the hash from its
+// signature algorithm, or SHA-256 if that is MD5 or SHA-1 (RFC 5929
+// section 4.1).
+func tlsServerEndPoint(cert *x509.Certificate) []byte {
+	var h hash.Hash
+	switch cert.SignatureAlgorithm {
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384, x509.SHA384WithRSAPSS:
+		h = sha512.New384()
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512, x509.SHA512WithRSAPSS:
+		h = sha512.New()
+	default:
+		h = sha256.New()
+	}
+	h.Write(cert.Raw)
+	return h.Sum(nil)
+}
+
+// scramHi is the Hi function of RFC 5802 section 2.2, which is PBKDF2
+// with the output length of the HMAC.
+func scramHi(h func() hash.Hash, password, salt []byte, iterations int) []byte {
+	mac := hmac.New(h, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	result := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+	return result
+}
+
+// scramName escapes a username or authzid for a SCRAM message.
+func scramName(s string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(s)
+}
+
+// scramAttributes parses a SCRAM message into its attributes.
+func scramAttributes(msg string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	for _, part := range strings.Split(msg, ",") {
+		if len(part) < 2 || part[1] != '=' {
+			return nil, LDAPError{"invalid SCRAM message " + strconv.Quote(msg)}
+		}
+		attrs[part[:1]] = part[2:]
+	}
+	if _, ok := attrs["m"]; ok {
+		return nil, LDAPError{"unsupported mandatory SCRAM extension"}
+	}
+	return attrs, nil
+}
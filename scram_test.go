@@ -0,0 +1,160 @@
+package ldap
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestScramExchanges(t *testing.T) {
+	tests := []struct {
+		mechanism                SASLMechanism
+		nonce                    string
+		clientFirst, serverFirst string
+		clientFinal, serverFinal string
+	}{
+		// RFC 5802 section 5
+		{
+			mechanism:   SASLScramSHA1("", "user", "pencil"),
+			nonce:       "fyko+d2lbbFgONRv9qkxdawL",
+			clientFirst: "n,,n=user,r=fyko+d2lbbFgONRv9qkxdawL",
+			serverFirst: "r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+			clientFinal: "c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+			serverFinal: "v=rmF9pqV8S7suAoZWja4dJRkFsKQ=",
+		},
+		// RFC 7677 section 3
+		{
+			mechanism:   SASLScramSHA256("", "user", "pencil"),
+			nonce:       "rOprNGfwEbeRWgbNEkqO",
+			clientFirst: "n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+			serverFirst: "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			clientFinal: "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+			serverFinal: "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+		},
+	}
+	for _, test := range tests {
+		m := test.mechanism.(*scramMechanism)
+		m.newNonce = fixedNonce(test.nonce)
+
+		// The same mechanism may be used for more than one bind.
+		for i := 0; i < 2; i++ {
+			name, initial, err := m.Start()
+			assert.NoError(t, err)
+			assert.Equal(t, m.name, name)
+			assert.Equal(t, test.clientFirst, string(initial))
+
+			resp, err := m.Next([]byte(test.serverFirst), true)
+			assert.NoError(t, err)
+			assert.Equal(t, test.clientFinal, string(resp))
+
+			_, err = m.Next([]byte(test.serverFinal), false)
+			assert.NoError(t, err, name)
+		}
+	}
+}
+
+func TestScramNoncePerExchange(t *testing.T) {
+	m := SASLScramSHA256("", "user", "pencil")
+	_, first, err := m.Start()
+	assert.NoError(t, err)
+	_, second, err := m.Start()
+	assert.NoError(t, err)
+	assert.NotEqual(t, string(first), string(second))
+}
+
+func TestScramRejectsServer(t *testing.T) {
+	const serverFirst = "r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096"
+	tests := []struct {
+		serverFirst, serverFinal string
+	}{
+		{"r=someoneelse,s=QSXCR+Q6sek8bf92,i=4096", ""},
+		{"r=fyko+d2lbbFgONRv9qkxdawL,s=QSXCR+Q6sek8bf92,i=4096", ""},
+		{"r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=0", ""},
+		{"m=ext,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096", ""},
+		{serverFirst, "v=AAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+		{serverFirst, "e=invalid-proof"},
+		{serverFirst, ""},
+	}
+	for _, test := range tests {
+		m := SASLScramSHA1("", "user", "pencil").(*scramMechanism)
+		m.newNonce = fixedNonce("fyko+d2lbbFgONRv9qkxdawL")
+		_, _, err := m.Start()
+		assert.NoError(t, err)
+		_, err = m.Next([]byte(test.serverFirst), true)
+		if test.serverFirst != serverFirst {
+			assert.Error(t, err, test.serverFirst)
+			continue
+		}
+		assert.NoError(t, err)
+		_, err = m.Next([]byte(test.serverFinal), false)
+		assert.Error(t, err, test.serverFinal)
+	}
+}
+
+func TestScramEscapesNames(t *testing.T) {
+	m := SASLScramSHA256("u:admin,x", "a=b,c", "pencil").(*scramMechanism)
+	m.newNonce = fixedNonce("abc")
+	_, initial, err := m.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, "n,a=u:admin=2Cx,n=a=3Db=2Cc,r=abc", string(initial))
+}
+
+func TestScramPlusRequiresTLS(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {})
+	defer wait()
+
+	assert.Error(t, conn.SASLBind(SASLScramSHA256Plus("", "user", "pencil")))
+}
+
+func TestScramChannelBinding(t *testing.T) {
+	cert := testCertificate(t, "localhost")
+	endPoint := sha256.Sum256(cert.Certificate[0])
+
+	tests := []struct {
+		mechanism  SASLMechanism
+		maxVersion uint16
+		header     string
+		data       func(s *testServer) []byte
+	}{
+		{SASLScramSHA256Plus("", "user", "pencil"), tls.VersionTLS12, "p=tls-unique,,", func(s *testServer) []byte {
+			return s.Conn.(*tls.Conn).ConnectionState().TLSUnique
+		}},
+		{SASLScramSHA1Plus("", "user", "pencil"), tls.VersionTLS13, "p=tls-server-end-point,,", func(s *testServer) []byte {
+			return endPoint[:]
+		}},
+		{SASLScramSHA256("", "user", "pencil"), tls.VersionTLS13, "n,,", func(s *testServer) []byte {
+			return nil
+		}},
+	}
+	for _, test := range tests {
+		func() {
+			serverConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MaxVersion: test.maxVersion}
+			conn, wait := newTestConn(t, func(s *testServer) {
+				if !s.startTestTLS(serverConfig) {
+					return
+				}
+				id, creds := s.readSASLBind()
+				assert.True(t, strings.HasPrefix(string(creds.Credentials), test.header), string(creds.Credentials))
+				nonce := strings.SplitN(string(creds.Credentials), ",r=", 2)[1]
+				s.writeBindResponse(id, SaslBindInProgress, []byte("r="+nonce+"x,s=QSXCR+Q6sek8bf92,i=4096"))
+
+				id, creds = s.readSASLBind()
+				expected := base64.StdEncoding.EncodeToString(append([]byte(test.header), test.data(s)...))
+				assert.True(t, strings.HasPrefix(string(creds.Credentials), "c="+expected+","), string(creds.Credentials))
+				s.writeBindResponse(id, InvalidCredentials, nil)
+			})
+			defer wait()
+
+			if !assert.NoError(t, conn.StartTLS(&tls.Config{InsecureSkipVerify: true})) {
+				return
+			}
+			err := conn.SASLBind(test.mechanism)
+			assert.True(t, errors.Is(err, InvalidCredentials), "unexpected error: %v", err)
+		}()
+	}
+}
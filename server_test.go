@@ -0,0 +1,117 @@
+package ldap
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stesla/ldap/asn1"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+// testServer is the server end of an in-memory connection, used to
+// script the responses to a client under test.
+type testServer struct {
+	t *testing.T
+	net.Conn
+	dec *asn1.Decoder
+}
+
+// newTestConn returns a client connected to a testServer running
+// serve. Call the returned function to close the client and wait for
+// serve to finish.
+func newTestConn(t *testing.T, serve func(s *testServer)) (*conn, func()) {
+	client, server := net.Pipe()
+	s := &testServer{t: t, Conn: server, dec: asn1.NewDecoder(server)}
+	s.dec.Implicit = true
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer server.Close()
+		serve(s)
+	}()
+	c := newConn(client)
+	return c, func() {
+		c.Close()
+		<-done
+	}
+}
+
+// readRequest reads a single message from the client, returning its
+// message id and its protocolOp.
+func (s *testServer) readRequest() (id int, op asn1.RawValue) {
+	id, op, _ = s.readRequestControls()
+	return
+}
+
+func (s *testServer) readRequestControls() (id int, op asn1.RawValue, controls []control) {
+	msg := ldapMessage{ProtocolOp: &op}
+	if err := s.dec.Decode(&msg); !assert.NoError(s.t, err, "reading request") {
+		return
+	}
+	return msg.MessageId, op, msg.Controls
+}
+
+// decodeRequest decodes the protocolOp from readRequest into out,
+// which must match opts.
+func (s *testServer) decodeRequest(op asn1.RawValue, opts string, out interface{}) bool {
+	dec := asn1.NewDecoder(bytes.NewBuffer(op.RawBytes))
+	dec.Implicit = true
+	err := dec.Decode(asn1.OptionValue{Opts: opts, Value: out})
+	return assert.NoError(s.t, err, "decoding request")
+}
+
+func (s *testServer) writeResponse(id int, op asn1.OptionValue, controls ...control) {
+	enc := asn1.NewEncoder(s)
+	enc.Implicit = true
+	err := enc.Encode(ldapMessage{MessageId: id, ProtocolOp: op, Controls: controls})
+	assert.NoError(s.t, err, "writing response")
+}
+
+// startTLS switches the server end of the connection to TLS.
+func (s *testServer) startTLS(config *tls.Config) bool {
+	tlsConn := tls.Server(s.Conn, config)
+	if !assert.NoError(s.t, tlsConn.Handshake(), "server handshake") {
+		return false
+	}
+	s.Conn = tlsConn
+	s.dec = asn1.NewDecoder(tlsConn)
+	s.dec.Implicit = true
+	return true
+}
+
+// startTestTLS answers a StartTLS request and switches the server to
+// TLS.
+func (s *testServer) startTestTLS(config *tls.Config) bool {
+	id, _ := s.readRequest()
+	s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:24", Value: extendedResponse{}})
+	return s.startTLS(config)
+}
+
+// testCertificate returns a self-signed certificate for tests.
+func testCertificate(t *testing.T, name string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,164 @@
+package ldap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/stesla/ldap/asn1"
+)
+
+// The Server Side Sorting controls, from RFC 2891.
+const (
+	sortRequestOID  = "1.2.840.113556.1.4.473"
+	sortResponseOID = "1.2.840.113556.1.4.474"
+)
+
+// SortKey is a key by which the server sorts search results.
+type SortKey struct {
+	Attribute string
+
+	// OrderingRule is the matching rule used to order the values.
+	// If it is empty, the attribute's ordering rule is used.
+	OrderingRule string
+
+	// Reverse sorts in descending rather than ascending order.
+	Reverse bool
+}
+
+// SortControl is the sort request control. It asks the server to sort
+// the results of a search by Keys, the first key being the most
+// significant.
+type SortControl struct {
+	Keys        []SortKey
+	Criticality bool
+}
+
+type sortKey struct {
+	AttributeType []byte
+	OrderingRule  []byte `asn1:"tag:0,optional"`
+	ReverseOrder  bool   `asn1:"tag:1,optional"`
+}
+
+func (c SortControl) OID() string    { return sortRequestOID }
+func (c SortControl) Critical() bool { return c.Criticality }
+
+func (c SortControl) Value() ([]byte, error) {
+	keys := make([]sortKey, len(c.Keys))
+	for i, k := range c.Keys {
+		keys[i] = sortKey{
+			AttributeType: []byte(k.Attribute),
+			OrderingRule:  optionalBytes(k.OrderingRule),
+			ReverseOrder:  k.Reverse,
+		}
+	}
+	var buf bytes.Buffer
+	enc := asn1.NewEncoder(&buf)
+	enc.Implicit = true
+	if err := enc.Encode(keys); err != nil {
+		return nil, fmt.Errorf("Encode: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// SortResultControl is the sort response control, with which the
+// server reports whether it could sort the results of a search.
+type SortResultControl struct {
+	// Result is Success if the results were sorted. Otherwise it
+	// says why they were not.
+	Result ResultCode
+
+	// Attribute is the attribute that caused the sort to fail, if
+	// the server says.
+	Attribute string
+
+	Criticality bool
+}
+
+type sortResult struct {
+	SortResult    ResultCode `asn1:"enum"`
+	AttributeType []byte     `asn1:"tag:0,optional"`
+}
+
+func (c SortResultControl) OID() string    { return sortResponseOID }
+func (c SortResultControl) Critical() bool { return c.Criticality }
+
+func (c SortResultControl) Value() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := asn1.NewEncoder(&buf)
+	enc.Implicit = true
+	err := enc.Encode(sortResult{SortResult: c.Result, AttributeType: optionalBytes(c.Attribute)})
+	if err != nil {
+		return nil, fmt.Errorf("Encode: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Err returns nil if the results were sorted and a *SortError
+// otherwise.
+func (c SortResultControl) Err() error {
+	if c.Result == Success {
+		return nil
+	}
+	return &SortError{Result: c.Result, Attribute: c.Attribute}
+}
+
+func decodeSortResultControl(criticality bool, value []byte) (Control, error) {
+	var r sortResult
+	dec := asn1.NewDecoder(bytes.NewBuffer(value))
+	dec.Implicit = true
+	if err := dec.Decode(&r); err != nil {
+		return nil, err
+	}
+	return SortResultControl{Result: r.SortResult, Attribute: string(r.AttributeType), Criticality: criticality}, nil
+}
+
+func init() {
+	RegisterControl(sortResponseOID, decodeSortResultControl)
+}
+
+// SortError is returned when the server could not sort the results of
+// a search.
+type SortError struct {
+	Result    ResultCode
+	Attribute string
+}
+
+func (e *SortError) Error() string {
+	msg := "LDAP sort error: " + e.Result.String()
+	if e.Attribute != "" {
+		msg += " (" + e.Attribute + ")"
+	}
+	return msg
+}
+
+// Is reports whether target is the same ResultCode as e's Result, so
+// that errors.Is(err, ldap.NoSuchAttribute) works.
+func (e *SortError) Is(target error) bool {
+	code, ok := target.(ResultCode)
+	return ok && code == e.Result
+}
+
+// SearchSorted performs req, asking the server to sort the results by
+// keys. The sort control is critical, so a server that does not
+// support sorting fails the search. If the server cannot sort the
+// results, SearchSorted returns a *SortError.
+func (l *conn) SearchSorted(req SearchRequest, keys ...SortKey) ([]SearchResult, error) {
+	return l.SearchSortedContext(context.Background(), req, keys...)
+}
+
+// SearchSortedContext is like SearchSorted.
+func (l *conn) SearchSortedContext(ctx context.Context, req SearchRequest, keys ...SortKey) ([]SearchResult, error) {
+	req.Controls = append(req.Controls[:len(req.Controls):len(req.Controls)], SortControl{Keys: keys, Criticality: true})
+	results, raw, err := l.search(ctx, req, nil)
+	controls, decodeErr := decodeControls(raw)
+	if err == nil && decodeErr != nil {
+		return nil, decodeErr
+	}
+	if c, ok := FindControl(controls, sortResponseOID).(SortResultControl); ok {
+		if sortErr := c.Err(); sortErr != nil {
+			return nil, sortErr
+		}
+	}
+	return results, err
+}
@@ -0,0 +1,129 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestSortControlValue(t *testing.T) {
+	c := SortControl{Keys: []SortKey{
+		{Attribute: "sn"},
+		{Attribute: "cn", OrderingRule: "2.5.13.3", Reverse: true},
+	}}
+	value, err := c.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x30, 0x19,
+		0x30, 0x04, 0x04, 0x02, 's', 'n',
+		0x30, 0x11, 0x04, 0x02, 'c', 'n',
+		0x80, 0x08, '2', '.', '5', '.', '1', '3', '.', '3',
+		0x81, 0x01, 0xff,
+	}, value)
+}
+
+func TestSortResultControlRoundTrip(t *testing.T) {
+	for _, c := range []SortResultControl{
+		{Result: Success},
+		{Result: NoSuchAttribute, Attribute: "sn", Criticality: true},
+	} {
+		value, err := c.Value()
+		if !assert.NoError(t, err) {
+			continue
+		}
+		decoded, err := decodeSortResultControl(c.Criticality, value)
+		assert.NoError(t, err)
+		assert.Equal(t, c, decoded)
+	}
+}
+
+// sortResultControl returns the wire form of a sort response control.
+func sortResultControl(t *testing.T, code ResultCode, attribute string) control {
+	value, err := SortResultControl{Result: code, Attribute: attribute}.Value()
+	assert.NoError(t, err)
+	return control{Type: []byte(sortResponseOID), Value: value}
+}
+
+func TestSearchSorted(t *testing.T) {
+	keys := []SortKey{{Attribute: "sn"}, {Attribute: "givenName", Reverse: true}}
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _, controls := s.readRequestControls()
+		if assert.Len(t, controls, 1) {
+			value, _ := SortControl{Keys: keys}.Value()
+			assert.Equal(t, control{Type: []byte(sortRequestOID), Criticality: true, Value: value}, controls[0])
+		}
+		s.writeResponse(id, searchEntry("uid=bob,ou=users,dc=example,dc=org"))
+		s.writeResponse(id, searchEntry("uid=alice,ou=users,dc=example,dc=org"))
+		s.writeResponse(id, searchDone(Success), sortResultControl(t, Success, ""))
+	})
+	defer wait()
+
+	results, err := conn.SearchSorted(SearchRequest{
+		BaseObject: []byte("ou=users,dc=example,dc=org"),
+		Scope:      SingleLevel,
+	}, keys...)
+	if assert.NoError(t, err) && assert.Len(t, results, 2) {
+		assert.Equal(t, "uid=bob,ou=users,dc=example,dc=org", results[0].DN)
+		assert.Equal(t, "uid=alice,ou=users,dc=example,dc=org", results[1].DN)
+	}
+}
+
+func TestSearchSortedFailure(t *testing.T) {
+	tests := []struct {
+		code     ResultCode
+		controls []control
+		sortErr  bool
+	}{
+		{UnavailableCriticalExtension, []control{sortResultControl(t, NoSuchAttribute, "sn")}, true},
+		{Success, []control{sortResultControl(t, UnwillingToPerform, "")}, true},
+		{UnavailableCriticalExtension, nil, false},
+	}
+	for _, test := range tests {
+		func() {
+			conn, wait := newTestConn(t, func(s *testServer) {
+				id, _ := s.readRequest()
+				s.writeResponse(id, searchDone(test.code), test.controls...)
+			})
+			defer wait()
+
+			_, err := conn.SearchSorted(SearchRequest{BaseObject: []byte("dc=example,dc=org")}, SortKey{Attribute: "sn"})
+			var sortErr *SortError
+			if test.sortErr {
+				if assert.True(t, errors.As(err, &sortErr), "unexpected error: %v", err) {
+					expected, _ := decodeSortResultControl(false, test.controls[0].Value)
+					assert.Equal(t, expected.(SortResultControl).Err(), sortErr)
+				}
+			} else {
+				assert.False(t, errors.As(err, &sortErr))
+				assert.True(t, errors.Is(err, test.code), "unexpected error: %v", err)
+			}
+		}()
+	}
+}
+
+func TestSortErrorIs(t *testing.T) {
+	err := SortResultControl{Result: NoSuchAttribute, Attribute: "sn"}.Err()
+	assert.True(t, errors.Is(err, NoSuchAttribute))
+	assert.False(t, errors.Is(err, UnwillingToPerform))
+	assert.Equal(t, "LDAP sort error: noSuchAttribute (sn)", err.Error())
+}
+
+func TestSortedPagedSearch(t *testing.T) {
+	sort := SortControl{Keys: []SortKey{{Attribute: "sn"}}}
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _, controls := s.readRequestControls()
+		if assert.Len(t, controls, 2) {
+			assert.Equal(t, pagedResultsOID, string(controls[0].Type))
+			assert.Equal(t, sortRequestOID, string(controls[1].Type))
+		}
+		cookie, _ := pagedResultsControl(0, nil)
+		s.writeResponse(id, searchDone(Success), cookie, sortResultControl(t, Success, ""))
+	})
+	defer wait()
+
+	req := SearchRequest{BaseObject: []byte("dc=example,dc=org"), Controls: []Control{sort}}
+	err := conn.SearchPagedFunc(context.Background(), req, 10, func([]SearchResult) error { return nil })
+	assert.NoError(t, err)
+}
@@ -0,0 +1,176 @@
+package ldap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stesla/ldap/asn1"
+)
+
+// SearchStream reads the results of a search from the connection as
+// they arrive, rather than waiting for the whole search to finish.
+//
+//	s, err := conn.SearchStream(ctx, req)
+//	if err != nil {
+//		return err
+//	}
+//	defer s.Close()
+//	for s.Next() {
+//		if entry := s.Entry(); entry != nil {
+//			...
+//		}
+//	}
+//	if err := s.Err(); err != nil {
+//		return err
+//	}
+//
+// Close is mandatory. Responses to a stream that is neither read to
+// the end nor closed are queued for as long as the connection is
+// open. The connection may be used for other operations while a
+// stream is being read, including from inside the loop.
+type SearchStream struct {
+	ctx context.Context
+	op  *operation
+
+	entry         *SearchResult
+	entryControls []Control
+	reference     []string
+
+	result   *Result
+	controls []control
+	err      error
+}
+
+func (l *conn) SearchStream(ctx context.Context, req SearchRequest) (*SearchStream, error) {
+	return l.searchStream(ctx, req, nil)
+}
+
+func (l *conn) searchStream(ctx context.Context, req SearchRequest, controls []control) (*SearchStream, error) {
+	encoded, err := req.encode()
+	if err != nil {
+		return nil, err
+	}
+	extra, err := encodeControls(req.Controls)
+	if err != nil {
+		return nil, err
+	}
+	controls = append(controls[:len(controls):len(controls)], extra...)
+	op, err := l.start(ctx, asn1.OptionValue{Opts: "application,tag:3", Value: encoded}, controls...)
+	if err != nil {
+		return nil, err
+	}
+	return &SearchStream{ctx: ctx, op: op}, nil
+}
+
+// Next advances to the next entry or continuation reference. It
+// returns false when the search is done, when it fails, or after
+// Close.
+func (s *SearchStream) Next() bool {
+	s.entry, s.entryControls, s.reference = nil, nil, nil
+	for s.op != nil {
+		p, err := s.op.receive(s.ctx)
+		if err != nil {
+			s.finish(err)
+			return false
+		}
+		switch p.ProtocolOp.Tag {
+		case 4: // SearchResultEntry
+			if s.entry, err = decodeEntry(p); err != nil {
+				s.finish(err)
+				return false
+			}
+			if s.entryControls, err = decodeControls(p.Controls); err != nil {
+				s.finish(err)
+				return false
+			}
+			return true
+		case 19: // SearchResultReference
+			if s.reference, err = decodeReference(p); err != nil {
+				s.finish(err)
+				return false
+			}
+			return true
+		case 5: // SearchResultDone
+			var r ldapResult
+			if err := p.decode("application,tag:5", &r); err != nil {
+				s.finish(fmt.Errorf("Decode SearchResultDone: %v", err))
+				return false
+			}
+			result := r.result()
+			s.result, s.controls = &result, p.Controls
+			s.finish(r.err())
+			return false
+		}
+	}
+	return false
+}
+
+func (s *SearchStream) finish(err error) {
+	s.err = err
+	s.op.finish()
+	s.op = nil
+}
+
+// Entry returns the current entry, or nil if Next stopped at a
+// continuation reference.
+func (s *SearchStream) Entry() *SearchResult { return s.entry }
+
+// EntryControls returns the controls sent with the current entry.
+func (s *SearchStream) EntryControls() []Control { return s.entryControls }
+
+// Reference returns the URLs of the current continuation reference,
+// or nil if Next stopped at an entry.
+func (s *SearchStream) Reference() []string { return s.reference }
+
+// Err returns the error, if any, that ended the search. A search that
+// the server completed unsuccessfully returns a *ResultError.
+func (s *SearchStream) Err() error { return s.err }
+
+// Result returns the result from the SearchResultDone, or nil if the
+// search has not completed.
+func (s *SearchStream) Result() *Result { return s.result }
+
+// Controls returns the controls from the SearchResultDone.
+func (s *SearchStream) Controls() ([]Control, error) { return decodeControls(s.controls) }
+
+// Close abandons the search if it has not yet completed.
+func (s *SearchStream) Close() error {
+	if s.op != nil {
+		s.op.abandon()
+		s.finish(nil)
+	}
+	return nil
+}
+
+type searchResultEntry struct {
+	Name       []byte
+	Attributes []attribute
+}
+
+func decodeEntry(p *packet) (*SearchResult, error) {
+	var r searchResultEntry
+	if err := p.decode("application,tag:4", &r); err != nil {
+		return nil, fmt.Errorf("Decode SearchResult: %v", err)
+	}
+	result := &SearchResult{DN: string(r.Name), Attributes: make(map[string][]string)}
+	for _, a := range r.Attributes {
+		vals := []string{}
+		for _, v := range a.Values {
+			vals = append(vals, string(v))
+		}
+		result.Attributes[string(a.Type)] = vals
+	}
+	return result, nil
+}
+
+func decodeReference(p *packet) ([]string, error) {
+	var urls [][]byte
+	if err := p.decode("application,tag:19", &urls); err != nil {
+		return nil, fmt.Errorf("Decode SearchResultReference: %v", err)
+	}
+	result := make([]string, len(urls))
+	for i, url := range urls {
+		result[i] = string(url)
+	}
+	return result, nil
+}
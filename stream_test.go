@@ -0,0 +1,146 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stesla/ldap/asn1"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func searchReference(urls ...string) asn1.OptionValue {
+	return asn1.OptionValue{Opts: "application,tag:19", Value: makeValues(urls)}
+}
+
+var testStreamRequest = SearchRequest{
+	BaseObject: []byte("dc=example,dc=org"),
+	Scope:      WholeSubtree,
+	Filter:     Present("objectClass"),
+}
+
+func TestSearchStream(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readRequest()
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:4", Value: searchResultEntry{
+			Name: []byte("uid=alice,ou=users,dc=example,dc=org"),
+			Attributes: []attribute{
+				{[]byte("uid"), [][]byte{[]byte("alice")}},
+			},
+		}})
+		s.writeResponse(id, searchReference("ldap://ldap2.example.org/ou=groups,dc=example,dc=org"))
+		s.writeResponse(id, searchDone(Success), control{Type: []byte("1.2.3.4"), Value: []byte("value")})
+	})
+	defer wait()
+
+	stream, err := conn.SearchStream(context.Background(), testStreamRequest)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close()
+
+	if assert.True(t, stream.Next()) {
+		assert.Equal(t, &SearchResult{
+			DN:         "uid=alice,ou=users,dc=example,dc=org",
+			Attributes: map[string][]string{"uid": {"alice"}},
+		}, stream.Entry())
+		assert.Nil(t, stream.Reference())
+	}
+	assert.Nil(t, stream.Result())
+
+	if assert.True(t, stream.Next()) {
+		assert.Nil(t, stream.Entry())
+		assert.Equal(t, []string{"ldap://ldap2.example.org/ou=groups,dc=example,dc=org"}, stream.Reference())
+	}
+
+	assert.False(t, stream.Next())
+	assert.NoError(t, stream.Err())
+	if assert.NotNil(t, stream.Result()) {
+		assert.Equal(t, Success, stream.Result().ResultCode)
+	}
+	controls, err := stream.Controls()
+	assert.NoError(t, err)
+	assert.Equal(t, []Control{RawControl{"1.2.3.4", false, []byte("value")}}, controls)
+	assert.False(t, stream.Next())
+}
+
+func TestSearchStreamFailure(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readRequest()
+		s.writeResponse(id, searchEntry("uid=alice,ou=users,dc=example,dc=org"))
+		s.writeResponse(id, searchDone(SizeLimitExceeded))
+	})
+	defer wait()
+
+	stream, err := conn.SearchStream(context.Background(), testStreamRequest)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close()
+
+	n := 0
+	for stream.Next() {
+		n++
+	}
+	assert.Equal(t, 1, n)
+	assert.True(t, errors.Is(stream.Err(), SizeLimitExceeded), "got %v", stream.Err())
+	if assert.NotNil(t, stream.Result()) {
+		assert.Equal(t, SizeLimitExceeded, stream.Result().ResultCode)
+	}
+}
+
+func TestSearchStreamCloseAbandons(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readRequest()
+		s.writeResponse(id, searchEntry("uid=alice,ou=users,dc=example,dc=org"))
+
+		_, op := s.readRequest()
+		var abandoned int
+		if s.decodeRequest(op, "application,tag:16", &abandoned) {
+			assert.Equal(t, id, abandoned)
+		}
+	})
+	defer wait()
+
+	stream, err := conn.SearchStream(context.Background(), testStreamRequest)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, stream.Next())
+	assert.NoError(t, stream.Close())
+	assert.False(t, stream.Next())
+	assert.NoError(t, stream.Err())
+	assert.Nil(t, stream.Result())
+}
+
+func TestSearchStreamUnreadDoesNotBlockConnection(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		searchID, _ := s.readRequest()
+		for i := 0; i < 40; i++ {
+			s.writeResponse(searchID, searchEntry("uid=alice,ou=users,dc=example,dc=org"))
+		}
+		id, _ := s.readRequest()
+		s.writeResponse(id, asn1.OptionValue{Opts: "application,tag:15", Value: ldapResult{
+			ResultCode: CompareTrue,
+		}})
+
+		_, op := s.readRequest()
+		var abandoned int
+		if s.decodeRequest(op, "application,tag:16", &abandoned) {
+			assert.Equal(t, searchID, abandoned)
+		}
+	})
+	defer wait()
+
+	stream, err := conn.SearchStream(context.Background(), testStreamRequest)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, stream.Next())
+
+	// The stream is not read again until it is closed.
+	ok, err := conn.Compare("cn=users,ou=groups,dc=example,dc=org", "memberUid", "alice")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, stream.Close())
+}
@@ -0,0 +1,99 @@
+package ldap
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// URL is an LDAP URL, as defined in RFC 4516, such as the URLs in a
+// referral or continuation reference.
+type URL struct {
+	Scheme     string // "ldap" or "ldaps"
+	Host       string // host or host:port
+	DN         string
+	Attributes []string
+	Scope      SearchScope
+	HasScope   bool // whether the URL specified Scope
+	Filter     string
+}
+
+// ParseURL parses an LDAP URL. Extensions are ignored unless they are
+// marked critical, in which case ParseURL returns an error, since it
+// does not recognize any.
+func ParseURL(s string) (*URL, error) {
+	u := &URL{}
+	i := strings.Index(s, "://")
+	if i < 0 {
+		return nil, LDAPError{"invalid LDAP URL " + s}
+	}
+	u.Scheme, s = strings.ToLower(s[:i]), s[i+3:]
+	if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return nil, LDAPError{"unsupported LDAP URL scheme " + u.Scheme}
+	}
+
+	if i = strings.IndexByte(s, '/'); i < 0 {
+		u.Host, s = s, ""
+	} else {
+		u.Host, s = s[:i], s[i+1:]
+	}
+
+	parts := strings.SplitN(s, "?", 5)
+	for i, p := range parts {
+		var err error
+		if parts[i], err = url.PathUnescape(p); err != nil {
+			return nil, LDAPError{"invalid LDAP URL: " + err.Error()}
+		}
+	}
+
+	u.DN = parts[0]
+	if len(parts) > 1 && parts[1] != "" {
+		u.Attributes = strings.Split(parts[1], ",")
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		u.HasScope = true
+		switch strings.ToLower(parts[2]) {
+		case "base":
+			u.Scope = BaseObject
+		case "one":
+			u.Scope = SingleLevel
+		case "sub":
+			u.Scope = WholeSubtree
+		default:
+			return nil, LDAPError{"invalid LDAP URL scope " + parts[2]}
+		}
+	}
+	if len(parts) > 3 {
+		u.Filter = parts[3]
+	}
+	if len(parts) > 4 {
+		for _, ext := range strings.Split(parts[4], ",") {
+			if strings.HasPrefix(ext, "!") {
+				return nil, LDAPError{"unsupported critical LDAP URL extension " + ext[1:]}
+			}
+		}
+	}
+	return u, nil
+}
+
+// Addr returns the host and port of u, using the default port for
+// the scheme if the URL has none.
+func (u *URL) Addr() string {
+	if _, _, err := net.SplitHostPort(u.Host); err == nil {
+		return u.Host
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(u.Host, "["), "]")
+	if host == "" {
+		host = "localhost"
+	}
+	if u.Scheme == "ldaps" {
+		return net.JoinHostPort(host, "636")
+	}
+	return net.JoinHostPort(host, "389")
+}
+
+// key identifies the server and entry u refers to, for detecting
+// referral loops.
+func (u *URL) key() string {
+	return u.Scheme + "://" + strings.ToLower(u.Addr()) + "/" + strings.ToLower(u.DN)
+}
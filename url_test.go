@@ -0,0 +1,48 @@
+package ldap
+
+import (
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestParseURL(t *testing.T) {
+	var tests = []struct {
+		in   string
+		ok   bool
+		out  URL
+		addr string
+	}{
+		{"ldap://ldap.example.org", true, URL{Scheme: "ldap", Host: "ldap.example.org"}, "ldap.example.org:389"},
+		{"ldaps://ldap.example.org:1636/", true, URL{Scheme: "ldaps", Host: "ldap.example.org:1636"}, "ldap.example.org:1636"},
+		{"LDAPS://[::1]/dc=example,dc=org", true, URL{Scheme: "ldaps", Host: "[::1]", DN: "dc=example,dc=org"}, "[::1]:636"},
+		{"ldap:///ou=users,dc=example,dc=org??one", true,
+			URL{Scheme: "ldap", DN: "ou=users,dc=example,dc=org", Scope: SingleLevel, HasScope: true}, "localhost:389"},
+		{"ldap://ldap2/cn=Alice%20Lastname,ou=users,dc=example,dc=org?cn,mail?base?(objectClass=*)?x-ext", true,
+			URL{
+				Scheme:     "ldap",
+				Host:       "ldap2",
+				DN:         "cn=Alice Lastname,ou=users,dc=example,dc=org",
+				Attributes: []string{"cn", "mail"},
+				Scope:      BaseObject,
+				HasScope:   true,
+				Filter:     "(objectClass=*)",
+			}, "ldap2:389"},
+		{"ldap://ldap2/??sub?%28uid%3dalice%29", true,
+			URL{Scheme: "ldap", Host: "ldap2", Scope: WholeSubtree, HasScope: true, Filter: "(uid=alice)"}, "ldap2:389"},
+		{"ldap://ldap2/????!x-critical", false, URL{}, ""},
+		{"ldap://ldap2/??subtree", false, URL{}, ""},
+		{"ldap://ldap2/%zz", false, URL{}, ""},
+		{"http://ldap.example.org/", false, URL{}, ""},
+		{"ldap.example.org", false, URL{}, ""},
+	}
+
+	for _, test := range tests {
+		u, err := ParseURL(test.in)
+		if !assert.Equal(t, test.ok, err == nil, "%s: %v", test.in, err) || !test.ok {
+			continue
+		}
+		assert.Equal(t, test.out, *u, test.in)
+		assert.Equal(t, test.addr, u.Addr(), test.in)
+	}
+}
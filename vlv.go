@@ -0,0 +1,212 @@
+package ldap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/stesla/ldap/asn1"
+)
+
+// The Virtual List View controls, from draft-ietf-ldapext-ldapv3-vlv.
+const (
+	vlvRequestOID  = "2.16.840.1.113730.3.4.9"
+	vlvResponseOID = "2.16.840.1.113730.3.4.10"
+)
+
+// VLVControl is the Virtual List View request control. It asks the
+// server to return a window of the sorted results of a search: the
+// target entry, BeforeCount entries before it and AfterCount entries
+// after it. The server only honours it together with a SortControl.
+type VLVControl struct {
+	BeforeCount int
+	AfterCount  int
+
+	// Offset is the position of the target in the list, starting
+	// from 1, and ContentCount is the client's estimate of the size
+	// of the list, or 0 if it has none. The server scales Offset to
+	// the actual size of the list.
+	Offset       int
+	ContentCount int
+
+	// If ByValue is set, the target is instead the first entry whose
+	// value of the first sort key is greater than or equal to
+	// AssertionValue.
+	ByValue        bool
+	AssertionValue string
+
+	// ContextID is the ContextID from the server's previous
+	// VLVResultControl, if any.
+	ContextID []byte
+
+	Criticality bool
+}
+
+type vlvRequest struct {
+	BeforeCount int
+	AfterCount  int
+	Target      asn1.OptionValue
+	ContextID   []byte `asn1:"optional"`
+}
+
+type vlvByOffset struct {
+	Offset       int
+	ContentCount int
+}
+
+func (c VLVControl) OID() string    { return vlvRequestOID }
+func (c VLVControl) Critical() bool { return c.Criticality }
+
+func (c VLVControl) Value() ([]byte, error) {
+	req := vlvRequest{
+		BeforeCount: c.BeforeCount,
+		AfterCount:  c.AfterCount,
+		Target:      asn1.OptionValue{Opts: "tag:0", Value: vlvByOffset{c.Offset, c.ContentCount}},
+		ContextID:   c.ContextID,
+	}
+	if c.ByValue {
+		req.Target = asn1.OptionValue{Opts: "tag:1", Value: []byte(c.AssertionValue)}
+	}
+	var buf bytes.Buffer
+	enc := asn1.NewEncoder(&buf)
+	enc.Implicit = true
+	if err := enc.Encode(req); err != nil {
+		return nil, fmt.Errorf("Encode: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// VLVResultControl is the Virtual List View response control, with
+// which the server describes the window of results it returned.
+type VLVResultControl struct {
+	// TargetPosition is the position of the target entry in the
+	// list, starting from 1, and ContentCount is the server's
+	// estimate of the size of the list.
+	TargetPosition int
+	ContentCount   int
+
+	// Result is Success if the server returned the window. Otherwise
+	// it says why it did not.
+	Result ResultCode
+
+	// ContextID should be sent in the VLVControl of the next request
+	// for the same list.
+	ContextID []byte
+
+	Criticality bool
+}
+
+type vlvResponse struct {
+	TargetPosition int
+	ContentCount   int
+	Result         ResultCode `asn1:"enum"`
+	ContextID      []byte     `asn1:"optional"`
+}
+
+func (c VLVResultControl) OID() string    { return vlvResponseOID }
+func (c VLVResultControl) Critical() bool { return c.Criticality }
+
+func (c VLVResultControl) Value() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := asn1.NewEncoder(&buf)
+	enc.Implicit = true
+	err := enc.Encode(vlvResponse{
+		TargetPosition: c.TargetPosition,
+		ContentCount:   c.ContentCount,
+		Result:         c.Result,
+		ContextID:      c.ContextID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Encode: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Err returns nil if the server returned the window and a *VLVError
+// otherwise.
+func (c VLVResultControl) Err() error {
+	if c.Result == Success {
+		return nil
+	}
+	return &VLVError{Result: c.Result}
+}
+
+func decodeVLVResultControl(criticality bool, value []byte) (Control, error) {
+	var r vlvResponse
+	dec := asn1.NewDecoder(bytes.NewBuffer(value))
+	dec.Implicit = true
+	if err := dec.Decode(&r); err != nil {
+		return nil, err
+	}
+	return VLVResultControl{
+		TargetPosition: r.TargetPosition,
+		ContentCount:   r.ContentCount,
+		Result:         r.Result,
+		ContextID:      r.ContextID,
+		Criticality:    criticality,
+	}, nil
+}
+
+func init() {
+	RegisterControl(vlvResponseOID, decodeVLVResultControl)
+}
+
+// VLVError is returned when the server could not return a window of
+// the results of a search.
+type VLVError struct {
+	Result ResultCode
+}
+
+func (e *VLVError) Error() string {
+	return "LDAP virtual list view error: " + e.Result.String()
+}
+
+// Is reports whether target is the same ResultCode as e's Result, so
+// that errors.Is(err, ldap.OffsetRangeError) works.
+func (e *VLVError) Is(target error) bool {
+	code, ok := target.(ResultCode)
+	return ok && code == e.Result
+}
+
+// ErrNoVLVResponse is returned by SearchVLV when the server completes
+// the search without a VLVResultControl, so the results cannot be
+// placed in the list.
+var ErrNoVLVResponse = LDAPError{"no virtual list view response control"}
+
+// SearchVLV performs req, asking the server to sort the results by
+// keys and return the window of them described by vlv. Both controls
+// are sent critical. It returns the server's VLVResultControl, whose
+// ContextID and ContentCount are useful for the next request. If the
+// server cannot sort the results, SearchVLV returns a *SortError, and
+// if it cannot return the window, a *VLVError. If the search succeeds
+// without a VLVResultControl, it returns ErrNoVLVResponse.
+func (l *conn) SearchVLV(req SearchRequest, keys []SortKey, vlv VLVControl) ([]SearchResult, VLVResultControl, error) {
+	return l.SearchVLVContext(context.Background(), req, keys, vlv)
+}
+
+// SearchVLVContext is like SearchVLV.
+func (l *conn) SearchVLVContext(ctx context.Context, req SearchRequest, keys []SortKey, vlv VLVControl) ([]SearchResult, VLVResultControl, error) {
+	vlv.Criticality = true
+	req.Controls = append(req.Controls[:len(req.Controls):len(req.Controls)], SortControl{Keys: keys, Criticality: true}, vlv)
+	results, raw, err := l.search(ctx, req, nil)
+	controls, decodeErr := decodeControls(raw)
+	if err == nil && decodeErr != nil {
+		return nil, VLVResultControl{}, decodeErr
+	}
+	if c, ok := FindControl(controls, sortResponseOID).(SortResultControl); ok {
+		if sortErr := c.Err(); sortErr != nil {
+			return nil, VLVResultControl{}, sortErr
+		}
+	}
+	c, ok := FindControl(controls, vlvResponseOID).(VLVResultControl)
+	if !ok {
+		if err == nil {
+			err = ErrNoVLVResponse
+		}
+		return nil, c, err
+	}
+	if vlvErr := c.Err(); vlvErr != nil {
+		return nil, c, vlvErr
+	}
+	return results, c, err
+}
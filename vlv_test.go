@@ -0,0 +1,109 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestVLVControlValue(t *testing.T) {
+	value, err := VLVControl{BeforeCount: 1, AfterCount: 2, Offset: 5}.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x30, 0x0e,
+		0x02, 0x01, 0x01,
+		0x02, 0x01, 0x02,
+		0xa0, 0x06, 0x02, 0x01, 0x05, 0x02, 0x01, 0x00,
+	}, value)
+
+	value, err = VLVControl{AfterCount: 3, ByValue: true, AssertionValue: "m", ContextID: []byte("ab")}.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x30, 0x0d,
+		0x02, 0x01, 0x00,
+		0x02, 0x01, 0x03,
+		0x81, 0x01, 'm',
+		0x04, 0x02, 'a', 'b',
+	}, value)
+}
+
+func TestVLVResultControlRoundTrip(t *testing.T) {
+	for _, c := range []VLVResultControl{
+		{TargetPosition: 5, ContentCount: 100, Result: Success, ContextID: []byte("ctx")},
+		{Result: OffsetRangeError, Criticality: true},
+	} {
+		value, err := c.Value()
+		if !assert.NoError(t, err) {
+			continue
+		}
+		decoded, err := decodeVLVResultControl(c.Criticality, value)
+		assert.NoError(t, err)
+		assert.Equal(t, c, decoded)
+	}
+}
+
+// vlvResultControl returns the wire form of a VLV response control.
+func vlvResultControl(t *testing.T, c VLVResultControl) control {
+	value, err := c.Value()
+	assert.NoError(t, err)
+	return control{Type: []byte(vlvResponseOID), Value: value}
+}
+
+func TestSearchVLV(t *testing.T) {
+	keys := []SortKey{{Attribute: "sn"}}
+	req := SearchRequest{BaseObject: []byte("ou=users,dc=example,dc=org"), Scope: SingleLevel}
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _, controls := s.readRequestControls()
+		if assert.Len(t, controls, 2) {
+			value, _ := SortControl{Keys: keys}.Value()
+			assert.Equal(t, control{Type: []byte(sortRequestOID), Criticality: true, Value: value}, controls[0])
+			value, _ = VLVControl{AfterCount: 1, Offset: 1}.Value()
+			assert.Equal(t, control{Type: []byte(vlvRequestOID), Criticality: true, Value: value}, controls[1])
+		}
+		s.writeResponse(id, searchEntry("uid=alice,ou=users,dc=example,dc=org"))
+		s.writeResponse(id, searchEntry("uid=bob,ou=users,dc=example,dc=org"))
+		s.writeResponse(id, searchDone(Success),
+			sortResultControl(t, Success, ""),
+			vlvResultControl(t, VLVResultControl{TargetPosition: 1, ContentCount: 3, ContextID: []byte("ctx")}))
+
+		id, _, controls = s.readRequestControls()
+		if assert.Len(t, controls, 2) {
+			value, _ := VLVControl{BeforeCount: 1, ByValue: true, AssertionValue: "c", ContextID: []byte("ctx")}.Value()
+			assert.Equal(t, value, controls[1].Value)
+		}
+		s.writeResponse(id, searchDone(Success),
+			vlvResultControl(t, VLVResultControl{Result: OffsetRangeError}))
+	})
+	defer wait()
+
+	results, c, err := conn.SearchVLV(req, keys, VLVControl{AfterCount: 1, Offset: 1})
+	if assert.NoError(t, err) && assert.Len(t, results, 2) {
+		assert.Equal(t, "uid=alice,ou=users,dc=example,dc=org", results[0].DN)
+		assert.Equal(t, "uid=bob,ou=users,dc=example,dc=org", results[1].DN)
+	}
+	assert.Equal(t, 1, c.TargetPosition)
+	assert.Equal(t, 3, c.ContentCount)
+
+	_, c, err = conn.SearchVLV(req, keys, VLVControl{BeforeCount: 1, ByValue: true, AssertionValue: "c", ContextID: c.ContextID})
+	var vlvErr *VLVError
+	if assert.True(t, errors.As(err, &vlvErr), "unexpected error: %v", err) {
+		assert.True(t, errors.Is(err, OffsetRangeError))
+		assert.Equal(t, "LDAP virtual list view error: offsetRangeError", err.Error())
+	}
+	assert.Equal(t, OffsetRangeError, c.Result)
+}
+
+func TestSearchVLVWithoutResponseControl(t *testing.T) {
+	conn, wait := newTestConn(t, func(s *testServer) {
+		id, _ := s.readRequest()
+		s.writeResponse(id, searchEntry("uid=alice,ou=users,dc=example,dc=org"))
+		s.writeResponse(id, searchDone(Success), sortResultControl(t, Success, ""))
+	})
+	defer wait()
+
+	results, _, err := conn.SearchVLV(SearchRequest{BaseObject: []byte("dc=example,dc=org")},
+		[]SortKey{{Attribute: "sn"}}, VLVControl{AfterCount: 1, Offset: 1})
+	assert.Equal(t, ErrNoVLVResponse, err)
+	assert.Nil(t, results)
+}